@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	backupFormatJSONL = "jsonl"
+	backupFormatSQL   = "sql"
+	// backupManifest 是备份目录中描述各表文件的清单
+	backupManifest = "manifest.json"
+	// backupSQLRows 是 SQL 格式备份中每条 INSERT 包含的行数
+	backupSQLRows = 100
+)
+
+// backupInfo 是备份目录中的 manifest.json
+type backupInfo struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Driver 是备份时目标库的驱动，SQL 格式只能恢复到同一种数据库
+	Driver string `json:"driver"`
+	// Target 是目标库连接串的指纹，恢复到其他库时给出提示
+	Target string        `json:"target"`
+	Format string        `json:"format"`
+	Tables []backupTable `json:"tables"`
+}
+
+type backupTable struct {
+	Table   string   `json:"table"`
+	File    string   `json:"file"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+}
+
+func parseBackupFormat(s string) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(s)); f {
+	case backupFormatJSONL, backupFormatSQL:
+		return f, nil
+	default:
+		return "", fmt.Errorf("未知的备份格式 %q（可选 jsonl/sql）", s)
+	}
+}
+
+// backupTarget 把迁移规则涉及的目标库表导出到 dir 下按时间命名的子目录，返回该子目录
+func backupTarget(newDB *sql.DB, dir, format string) (string, error) {
+	newDriver, _ := detectDriver(config.NewDSN)
+	path := filepath.Join(dir, "target-backup-"+time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return "", fmt.Errorf("创建备份目录失败: %w", err)
+	}
+
+	info := backupInfo{CreatedAt: time.Now(), Driver: newDriver, Target: dsnFingerprint(config.NewDSN), Format: format}
+	seen := make(map[string]bool)
+	for _, tm := range mapping.Tables {
+		if seen[tm.Target] {
+			continue
+		}
+		seen[tm.Target] = true
+		if ok, err := tableExists(newDB, newDriver, tm.Target); err != nil {
+			return "", fmt.Errorf("检查目标库表 %s 失败: %w", tm.Target, err)
+		} else if !ok {
+			continue
+		}
+		t := backupTable{Table: tm.Target, File: tm.Target + "." + format}
+		if err := backupTableTo(newDB, newDriver, filepath.Join(path, t.File), format, &t); err != nil {
+			return "", fmt.Errorf("备份目标库表 %s 失败: %w", tm.Target, err)
+		}
+		fmt.Fprintf(console, "💾 已备份目标库表 %s（%d 行）\n", t.Table, t.Rows)
+		info.Tables = append(info.Tables, t)
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(path, backupManifest), append(data, '\n'), 0o600); err != nil {
+		return "", fmt.Errorf("写入备份清单失败: %w", err)
+	}
+	return path, nil
+}
+
+// backupTableTo 导出一张表。jsonl 每行一个 {列名: 值} 对象；sql 为先 DELETE 再多行 INSERT 的语句，可直接用数据库客户端执行
+func backupTableTo(db *sql.DB, driver, file, format string, t *backupTable) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s", quoteIdent(driver, t.Table)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if t.Columns, err = rows.Columns(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	quotedCols := make([]string, 0, len(t.Columns))
+	for _, col := range t.Columns {
+		quotedCols = append(quotedCols, quoteIdent(driver, col))
+	}
+	insertPrefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", quoteIdent(driver, t.Table), strings.Join(quotedCols, ","))
+	if format == backupFormatSQL {
+		fmt.Fprintf(w, "-- %s backup of %s, %s\nDELETE FROM %s;\n", driver, t.Table, time.Now().Format(time.RFC3339), quoteIdent(driver, t.Table))
+	}
+
+	values := make([]any, len(t.Columns))
+	ptrs := make([]any, len(t.Columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	pending := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		t.Rows++
+		if format == backupFormatJSONL {
+			record := make(map[string]any, len(values))
+			for i, col := range t.Columns {
+				record[col] = backupValue(values[i])
+			}
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			w.Write(data)
+			w.WriteByte('\n')
+			continue
+		}
+
+		literals := make([]string, 0, len(values))
+		for _, v := range values {
+			literals = append(literals, sqlLiteral(driver, v))
+		}
+		if pending == 0 {
+			w.WriteString(insertPrefix)
+		} else {
+			w.WriteString(",\n")
+		}
+		w.WriteString("(" + strings.Join(literals, ",") + ")")
+		if pending++; pending == backupSQLRows {
+			w.WriteString(";\n")
+			pending = 0
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if pending > 0 {
+		w.WriteString(";\n")
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// backupValue 把驱动返回的值转成可写入 JSON 的值，MySQL 以 []byte 返回的文本转为字符串
+func backupValue(v any) any {
+	switch val := v.(type) {
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.Format("2006-01-02 15:04:05.999999999-07:00")
+	default:
+		return val
+	}
+}
+
+// sqlLiteral 把值写成 driver 方言的 SQL 字面量
+func sqlLiteral(driver string, v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case bool:
+		if driver == "postgres" {
+			return strings.ToUpper(strconv.FormatBool(val))
+		}
+		if val {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return "'" + val.Format("2006-01-02 15:04:05.999999999-07:00") + "'"
+	case []byte:
+		if !utf8.Valid(val) {
+			return sqlBlobLiteral(driver, val)
+		}
+		return sqlStringLiteral(driver, string(val))
+	default:
+		return sqlStringLiteral(driver, fmt.Sprint(val))
+	}
+}
+
+func sqlStringLiteral(driver, s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if driver == "mysql" {
+		// MySQL 默认把反斜杠当作转义符
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + s + "'"
+}
+
+func sqlBlobLiteral(driver string, b []byte) string {
+	hex := fmt.Sprintf("%x", b)
+	if driver == "postgres" {
+		return `'\x` + hex + `'::bytea`
+	}
+	return "X'" + hex + "'"
+}
+
+// runRestore 是 restore 子命令：按备份清单清空并恢复目标库表，所有表在同一个事务中完成
+func runRestore() int {
+	info, err := readBackupInfo(options.restoreFrom)
+	if err != nil {
+		fmt.Fprintf(console, "⚠️ %v\n", err)
+		return exitUsage
+	}
+	newDriver, _ := detectDriver(config.NewDSN)
+	if info.Format == backupFormatSQL && info.Driver != newDriver {
+		fmt.Fprintf(console, "⚠️ SQL 格式的备份来自 %s，不能恢复到 %s；跨数据库恢复请使用 jsonl 格式的备份\n", info.Driver, newDriver)
+		return exitUsage
+	}
+	if info.Target != dsnFingerprint(config.NewDSN) {
+		fmt.Fprintln(console, "⚠️ 备份来自另一个目标库连接串，请确认恢复的是正确的数据库")
+	}
+	newDB := openDatabase(config.NewDSN)
+
+	names := make([]string, 0, len(info.Tables))
+	for _, t := range info.Tables {
+		names = append(names, fmt.Sprintf("%s(%d 行)", t.Table, t.Rows))
+	}
+	fmt.Fprintf(console, "♻️ 将清空目标库表并恢复为 %s 的备份: %s\n", info.CreatedAt.Format(time.RFC3339), strings.Join(names, ", "))
+	if !config.AssumeYes {
+		fmt.Fprint(console, "请输入 yes 确认恢复: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+			fmt.Fprintln(console, "⛔ 未确认恢复（非交互运行时请加 --yes）")
+			return exitUsage
+		}
+	}
+
+	tx, err := newDB.Begin()
+	if err != nil {
+		fmt.Fprintf(console, "⚠️ 开启事务失败: %v\n", err)
+		return exitTablesFailed
+	}
+	for _, t := range info.Tables {
+		file := filepath.Join(options.restoreFrom, t.File)
+		if info.Format == backupFormatSQL {
+			err = restoreSQL(tx, newDriver, file)
+		} else {
+			err = restoreJSONL(tx, newDB, newDriver, file, t)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			fmt.Fprintf(console, "⚠️ 恢复目标库表 %s 失败，已回滚: %v\n", t.Table, err)
+			return exitTablesFailed
+		}
+		fmt.Fprintf(console, "✅ 已恢复目标库表 %s（%d 行）\n", t.Table, t.Rows)
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Fprintf(console, "⚠️ 提交事务失败: %v\n", err)
+		return exitTablesFailed
+	}
+	// 恢复写入的同样是显式 id
+	var sequenced []string
+	for _, t := range info.Tables {
+		if indexOf(t.Columns, "id") != -1 {
+			sequenced = append(sequenced, t.Table)
+		}
+	}
+	resetSequences(newDB, sequenced)
+	logEvent("restore_done", eventFields{"from": options.restoreFrom, "tables": info.Tables}, "🚩目标库已恢复为备份时的状态🚩\n")
+	return exitOK
+}
+
+func readBackupInfo(dir string) (backupInfo, error) {
+	var info backupInfo
+	if dir == "" {
+		return info, errors.New("请用 --from 指定备份目录")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, backupManifest))
+	if err != nil {
+		return info, fmt.Errorf("读取备份清单失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("解析备份清单失败: %w", err)
+	}
+	return info, nil
+}
+
+// restoreJSONL 清空表后按清单中的列顺序批量写入 jsonl 中的行
+func restoreJSONL(tx *sql.Tx, db *sql.DB, driver, file string, t backupTable) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", quoteIdent(driver, t.Table))); err != nil {
+		return err
+	}
+	batcher := newInsertBatcher(tx, t.Table, t.Columns, driver, detectBatchLimits(db, driver, config.BatchSize), conflictError)
+	dec := json.NewDecoder(bufio.NewReader(f))
+	dec.UseNumber()
+	for {
+		var record map[string]any
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("解析 %s 失败: %w", file, err)
+		}
+		values := make([]any, 0, len(t.Columns))
+		for _, col := range t.Columns {
+			v := record[col]
+			if n, ok := v.(json.Number); ok {
+				if i, err := n.Int64(); err == nil {
+					v = i
+				} else if fv, err := n.Float64(); err == nil {
+					v = fv
+				}
+			}
+			values = append(values, v)
+		}
+		if err := batcher.add(values); err != nil {
+			return err
+		}
+	}
+	return batcher.flush()
+}
+
+// restoreSQL 逐条执行 SQL 格式备份中的语句（文件自带 DELETE）
+func restoreSQL(tx *sql.Tx, driver, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range splitSQLStatements(string(data), driver == "mysql") {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSQLStatements 按字符串字面量之外的分号拆分语句，并去掉 -- 注释行；
+// backslashEscapes 为 true 时字面量中的反斜杠转义下一个字符（MySQL）
+func splitSQLStatements(script string, backslashEscapes bool) []string {
+	var stmts []string
+	var b strings.Builder
+	inString := false
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case inString && backslashEscapes && c == '\\' && i+1 < len(script):
+			b.WriteByte(c)
+			i++
+			c = script[i]
+		case c == '\'':
+			inString = !inString
+		case !inString && c == '-' && strings.HasPrefix(script[i:], "--"):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			continue
+		case !inString && c == ';':
+			if stmt := strings.TrimSpace(b.String()); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			b.Reset()
+			continue
+		}
+		b.WriteByte(c)
+	}
+	if stmt := strings.TrimSpace(b.String()); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name             string
+		script           string
+		backslashEscapes bool
+		want             []string
+	}{
+		{name: "空脚本", script: " \n", want: nil},
+		{name: "按分号拆分", script: "DELETE FROM t;\nINSERT INTO t VALUES (1);", want: []string{"DELETE FROM t", "INSERT INTO t VALUES (1)"}},
+		{name: "末尾没有分号", script: "SELECT 1", want: []string{"SELECT 1"}},
+		{name: "空语句", script: ";;SELECT 1;;", want: []string{"SELECT 1"}},
+		{name: "字面量中的分号", script: "INSERT INTO t VALUES ('a;b');SELECT 1", want: []string{"INSERT INTO t VALUES ('a;b')", "SELECT 1"}},
+		{name: "两个单引号转义", script: "INSERT INTO t VALUES ('it''s;ok');", want: []string{"INSERT INTO t VALUES ('it''s;ok')"}},
+		{
+			name:   "注释行",
+			script: "-- 备份于 2024-01-01; 表 t\nDELETE FROM t; -- 清空\nINSERT INTO t VALUES (1);",
+			want:   []string{"DELETE FROM t", "INSERT INTO t VALUES (1)"},
+		},
+		{name: "字面量中的 --", script: "INSERT INTO t VALUES ('a--b');", want: []string{"INSERT INTO t VALUES ('a--b')"}},
+		{
+			name: "MySQL 反斜杠转义引号", script: `INSERT INTO t VALUES ('a\';b');SELECT 1`, backslashEscapes: true,
+			want: []string{`INSERT INTO t VALUES ('a\';b')`, "SELECT 1"},
+		},
+		{
+			name: "MySQL 字面量以反斜杠结尾", script: `INSERT INTO t VALUES ('a\\');SELECT 1`, backslashEscapes: true,
+			want: []string{`INSERT INTO t VALUES ('a\\')`, "SELECT 1"},
+		},
+		{
+			name: "其他数据库反斜杠不转义", script: `INSERT INTO t VALUES ('a\');SELECT 1`,
+			want: []string{`INSERT INTO t VALUES ('a\')`, "SELECT 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSQLStatements(tt.script, tt.backslashEscapes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSQLStatements(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
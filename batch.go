@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultBatchSize 是单条多行 INSERT 默认写入的行数
+	defaultBatchSize = 500
+	// postgres / mysql 预处理语句的占位符上限
+	maxPlaceholdersPostgres = 65535
+	maxPlaceholdersMySQL    = 65535
+	// SQLite 3.32.0 起 SQLITE_MAX_VARIABLE_NUMBER 默认 32766，更早的版本为 999
+	maxPlaceholdersSQLite       = 32766
+	maxPlaceholdersSQLiteLegacy = 999
+)
+
+// insertBatcher 把多行参数累积成一条多行 INSERT，在达到行数、占位符或报文大小上限时写入
+type insertBatcher struct {
+	tx       *sql.Tx
+	table    string
+	columns  []string
+	driver   string
+	policy   conflictPolicy
+	maxRows  int
+	maxBytes int // 0 表示不限制报文大小（仅 MySQL 需要）
+
+	args  []any
+	rows  int
+	bytes int
+	// written 是已经成功写入的行数
+	written int
+}
+
+func newInsertBatcher(tx *sql.Tx, table string, columns []string, driver string, limits batchLimits, policy conflictPolicy) *insertBatcher {
+	return &insertBatcher{
+		tx:       tx,
+		table:    table,
+		columns:  columns,
+		driver:   driver,
+		policy:   policy,
+		maxRows:  limits.rowsFor(len(columns)),
+		maxBytes: limits.MaxBytes,
+	}
+}
+
+// add 追加一行，必要时先写入已累积的批次
+func (b *insertBatcher) add(values []any) error {
+	size := estimateRowBytes(values)
+	if b.rows > 0 && b.maxBytes > 0 && b.bytes+size > b.maxBytes {
+		if err := b.flush(); err != nil {
+			return err
+		}
+	}
+	b.args = append(b.args, values...)
+	b.rows++
+	b.bytes += size
+	if b.rows >= b.maxRows {
+		return b.flush()
+	}
+	return nil
+}
+
+func (b *insertBatcher) flush() error {
+	if b.rows == 0 {
+		return nil
+	}
+	insertSQL := buildBulkInsertSQL(b.table, b.columns, b.driver, b.rows, b.policy)
+	if _, err := b.tx.Exec(insertSQL, b.args...); err != nil {
+		return err
+	}
+	b.written += b.rows
+	b.args = b.args[:0]
+	b.rows = 0
+	b.bytes = 0
+	return nil
+}
+
+// batchLimits 是目标库对单条多行 INSERT 的限制
+type batchLimits struct {
+	BatchSize       int
+	MaxPlaceholders int
+	MaxBytes        int
+}
+
+// rowsFor 返回 cols 列时单批最多可写入的行数
+func (l batchLimits) rowsFor(cols int) int {
+	rows := l.BatchSize
+	if rows <= 0 {
+		rows = defaultBatchSize
+	}
+	if cols > 0 && l.MaxPlaceholders > 0 && rows*cols > l.MaxPlaceholders {
+		rows = l.MaxPlaceholders / cols
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	return rows
+}
+
+// detectBatchLimits 根据目标库驱动与服务端配置确定批量写入上限
+func detectBatchLimits(db *sql.DB, driver string, batchSize int) batchLimits {
+	limits := batchLimits{BatchSize: batchSize}
+	switch driver {
+	case "postgres":
+		limits.MaxPlaceholders = maxPlaceholdersPostgres
+	case "mysql":
+		limits.MaxPlaceholders = maxPlaceholdersMySQL
+		var packet int64
+		if err := db.QueryRow("SELECT @@max_allowed_packet").Scan(&packet); err != nil {
+			fmt.Fprintf(console, "⚠️ 读取 MySQL max_allowed_packet 失败，按 4MB 处理: %v\n", err)
+			packet = 4 << 20
+		}
+		// 预留协议头与语句文本的空间
+		limits.MaxBytes = int(packet * 3 / 4)
+	case "sqlite":
+		limits.MaxPlaceholders = maxPlaceholdersSQLite
+		var version string
+		if err := db.QueryRow("SELECT sqlite_version()").Scan(&version); err == nil && !sqliteVersionAtLeast(version, 3, 32) {
+			limits.MaxPlaceholders = maxPlaceholdersSQLiteLegacy
+		}
+	}
+	return limits
+}
+
+func sqliteVersionAtLeast(version string, major, minor int) bool {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	gotMajor, err1 := strconv.Atoi(parts[0])
+	gotMinor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
+// estimateRowBytes 粗略估算一行参数在协议报文中占用的字节数
+func estimateRowBytes(values []any) int {
+	size := 0
+	for _, v := range values {
+		switch val := v.(type) {
+		case nil:
+			size += 1
+		case string:
+			size += len(val) + 9
+		case []byte:
+			size += len(val) + 9
+		case time.Time:
+			size += 12
+		default:
+			size += 9
+		}
+	}
+	return size
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 // MartialBE/one-hub (Source) Channel Types
@@ -143,29 +145,409 @@ var channelMap = map[int]int{
 	SourceChannelTypeReplicate:    TargetChannelTypeReplicate,
 }
 
-// upgradeChannelType converts the channel type from Source (MartialBE) to Target (songquanpeng)
-func upgradeChannelType(oldValue interface{}) interface{} {
-	var oldVal int
-	switch v := oldValue.(type) {
-	case int:
-		oldVal = v
-	case []uint8:
-		valStr := string(v)
-		valInt, err := strconv.Atoi(valStr)
+// parseChannelType extracts the integer channel type from a value scanned by any of the supported drivers
+func parseChannelType(value interface{}) (int, error) {
+	v, err := toInt64(value)
+	return int(v), err
+}
+
+// mapChannelType looks up the Target type for a Source channel type value; found is false when it becomes TargetChannelTypeUnknown
+func mapChannelType(oldValue interface{}) (oldVal int, newVal int, found bool, err error) {
+	oldVal, err = parseChannelType(oldValue)
+	if err != nil {
+		return 0, TargetChannelTypeUnknown, false, err
+	}
+	newVal, found = channelMap[oldVal]
+	if !found {
+		newVal = TargetChannelTypeUnknown
+	}
+	return oldVal, newVal, found, nil
+}
+
+// upgradeChannelType converts the channel type from Source (MartialBE) to Target (songquanpeng), applying the fallback for unmapped types
+func upgradeChannelType(id string, oldValue interface{}, baseURL string) channelDecision {
+	d := decideChannel(oldValue, baseURL)
+	fields := eventFields{"table": "channels", "id": id, "source_type": d.SourceType, "target_type": d.Type}
+	if d.Fallback != "" {
+		fields["fallback"] = d.Fallback
+		fields["disabled"] = d.Disable
+		fields["skipped"] = d.Skip
+	}
+	if _, err := parseChannelType(oldValue); err != nil {
+		if b, ok := oldValue.([]uint8); ok {
+			oldValue = string(b)
+		}
+		fields["source_type"] = fmt.Sprint(oldValue)
+		logEvent("channel_type", fields, "渠道Type旧值: %v (解析错误), 兜底策略 %s: %s\n", oldValue, d.Fallback, d.label())
+		return d
+	}
+
+	if d.Fallback == "" {
+		logEvent("channel_type", fields, "渠道Type旧值: %d, 新值: %d\n", d.SourceType, d.Type)
+		return d
+	}
+	logEvent("channel_type", fields, "渠道Type旧值: %d, 新值未找到, 兜底策略 %s: %s\n", d.SourceType, d.Fallback, d.label())
+	return d
+}
+
+// validTargetChannelType reports whether t is one of the TargetChannelType* constants usable for a channel
+func validTargetChannelType(t int) bool {
+	return t > TargetChannelTypeUnknown && t < TargetChannelTypeDummy
+}
+
+// parseChannelTypeOverride parses a "source=target" pair such as "60=50"
+func parseChannelTypeOverride(s string) (source, target int, err error) {
+	src, dst, ok := strings.Cut(s, "=")
+	if !ok {
+		return 0, 0, fmt.Errorf("渠道类型覆盖 %q 格式应为 源类型=目标类型，如 60=50", s)
+	}
+	source, err1 := strconv.Atoi(strings.TrimSpace(src))
+	target, err2 := strconv.Atoi(strings.TrimSpace(dst))
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("渠道类型覆盖 %q 中的类型不是整数", s)
+	}
+	return source, target, nil
+}
+
+// applyChannelTypeOverrides validates user-supplied Source -> Target types and merges them into channelMap.
+// It runs before migration starts so an invalid Target type aborts the run instead of producing broken channels.
+func applyChannelTypeOverrides(overrides map[int]int) error {
+	sources := make([]int, 0, len(overrides))
+	for src, dst := range overrides {
+		if !validTargetChannelType(dst) {
+			return fmt.Errorf("渠道类型覆盖 %d=%d 无效：目标类型应为 one-api 的渠道类型 %d-%d（没有对应类型时请使用 --channel-fallback）",
+				src, dst, TargetChannelTypeUnknown+1, TargetChannelTypeDummy-1)
+		}
+		sources = append(sources, src)
+	}
+	sort.Ints(sources)
+	for _, src := range sources {
+		dst := overrides[src]
+		if prev, ok := channelMap[src]; ok {
+			fmt.Fprintf(console, "🔧 渠道类型覆盖: %d -> %d（原映射为 %d）\n", src, dst, prev)
+		} else {
+			fmt.Fprintf(console, "🔧 渠道类型覆盖: %d -> %d（新增）\n", src, dst)
+		}
+		channelMap[src] = dst
+	}
+	return nil
+}
+
+// channelKeyLayout describes how a multi-part one-hub key (segments joined with `|`) maps onto one-api
+type channelKeyLayout struct {
+	// Target is the one-api channel type the layout converts to; a channel migrated as any other type
+	// (disabled, or sent to a different type by a fallback or override) keeps its key unchanged
+	Target int
+	// Parts names the one-hub key segments in order; a trailing "?" marks an optional segment
+	Parts []string
+	// Key lists the segments joined with `|` into the one-api key
+	Key []string
+	// Config maps one-api config JSON fields to key segments
+	Config map[string]string
+	// Columns maps one-api config JSON fields to other Source channel columns
+	Columns map[string]string
+	// SingleKey keeps the key whole instead of splitting it into one key per line,
+	// for layouts whose segments may span lines (Vertex AI ADC JSON)
+	SingleKey bool
+}
+
+// Key layouts by Source channel type; types not listed keep their key unchanged
+var channelKeyLayouts = map[int]channelKeyLayout{
+	SourceChannelTypeAzure: {
+		Target:  TargetChannelTypeAzure,
+		Parts:   []string{"api_key"},
+		Key:     []string{"api_key"},
+		Columns: map[string]string{"api_version": "other"},
+	},
+	SourceChannelTypeBaidu: {
+		Target: TargetChannelTypeBaidu,
+		Parts:  []string{"api_key", "secret_key"},
+		Key:    []string{"api_key", "secret_key"},
+	},
+	SourceChannelTypeXunfei: {
+		Target:  TargetChannelTypeXunfei,
+		Parts:   []string{"app_id", "api_secret", "api_key"},
+		Key:     []string{"app_id", "api_secret", "api_key"},
+		Columns: map[string]string{"api_version": "other"},
+	},
+	SourceChannelTypeTencent: {
+		Target: TargetChannelTypeTencent,
+		Parts:  []string{"app_id", "secret_id", "secret_key"},
+		Key:    []string{"app_id", "secret_id", "secret_key"},
+	},
+	SourceChannelTypeBedrock: {
+		Target: TargetChannelTypeAwsClaude,
+		Parts:  []string{"region", "ak", "sk", "session_token?"},
+		Key:    []string{"ak", "sk", "region"},
+		Config: map[string]string{"region": "region", "ak": "ak", "sk": "sk"},
+	},
+	SourceChannelTypeVertexAI: {
+		Target:    TargetChannelTypeVertextAI,
+		Parts:     []string{"region", "project_id", "adc"},
+		Key:       []string{"region", "project_id", "adc"},
+		Config:    map[string]string{"region": "region", "vertex_ai_project_id": "project_id", "vertex_ai_adc": "adc"},
+		SingleKey: true,
+	},
+	SourceChannelTypeCloudflareAI: {
+		Target: TargetChannelTypeCloudflare,
+		Parts:  []string{"account_id", "api_token"},
+		Key:    []string{"api_token"},
+		Config: map[string]string{"user_id": "account_id"},
+	},
+}
+
+// splitChannelKey splits a one-hub key into named segments, failing when the segment count does not match the layout
+// or when a non-empty segment has nowhere to go in one-api (e.g. a Bedrock session token)
+func splitChannelKey(layout channelKeyLayout, key string) (map[string]string, error) {
+	required := 0
+	for _, p := range layout.Parts {
+		if !strings.HasSuffix(p, "?") {
+			required++
+		}
+	}
+	segments := strings.Split(key, "|")
+	if len(segments) < required || len(segments) > len(layout.Parts) {
+		return nil, fmt.Errorf("应为 %s，实际为 %d 段", strings.Join(layout.Parts, "|"), len(segments))
+	}
+	parts := make(map[string]string, len(layout.Parts))
+	for i, name := range layout.Parts {
+		name = strings.TrimSuffix(name, "?")
+		if i < len(segments) {
+			parts[name] = strings.TrimSpace(segments[i])
+		}
+	}
+	for _, name := range layout.Parts {
+		if !strings.HasSuffix(name, "?") && parts[name] == "" {
+			return nil, fmt.Errorf("应为 %s，其中 %s 为空", strings.Join(layout.Parts, "|"), name)
+		}
+	}
+	for _, name := range layout.Parts {
+		if name = strings.TrimSuffix(name, "?"); parts[name] != "" && !layout.uses(name) {
+			return nil, fmt.Errorf("one-api 没有保存 %s 的位置，迁移后将丢失", name)
+		}
+	}
+	return parts, nil
+}
+
+// uses reports whether the segment is written to the one-api key or config
+func (l channelKeyLayout) uses(name string) bool {
+	if contains(l.Key, name) {
+		return true
+	}
+	for _, part := range l.Config {
+		if part == name {
+			return true
+		}
+	}
+	return false
+}
+
+// channelKeyLayoutFor returns the key layout of a Source type, only when the channel is migrated as the layout's target type
+func channelKeyLayoutFor(sourceType, targetType int) (channelKeyLayout, bool) {
+	layout, found := channelKeyLayouts[sourceType]
+	if !found || layout.Target != targetType {
+		return channelKeyLayout{}, false
+	}
+	return layout, true
+}
+
+// upgradeChannelKey converts a one-hub key into the one-api key and config fields for the given Source type
+// migrated as targetType (see channelDecision); other target types keep the key unchanged.
+// A channel may hold several keys, one per line; each is checked and converted on its own, and since config
+// holds a single value per field, the keys must agree on every config field.
+// When the type has a layout but a key does not match it, the key is returned unchanged with an error.
+func upgradeChannelKey(sourceType, targetType int, key string) (newKey string, configFields map[string]string, err error) {
+	layout, found := channelKeyLayoutFor(sourceType, targetType)
+	if !found || key == "" {
+		return key, nil, nil
+	}
+	lines := []string{key}
+	if !layout.SingleKey {
+		lines = lines[:0]
+		for _, line := range strings.Split(key, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	converted := make([]string, 0, len(lines))
+	for i, line := range lines {
+		parts, err := splitChannelKey(layout, line)
 		if err != nil {
-			fmt.Printf("渠道Type旧值: %s (解析错误), 新值: %d (未知类型)\n", valStr, TargetChannelTypeUnknown)
-			return TargetChannelTypeUnknown
+			if len(lines) > 1 {
+				err = fmt.Errorf("第 %d 个密钥: %w", i+1, err)
+			}
+			return key, nil, err
+		}
+		joined := make([]string, 0, len(layout.Key))
+		for _, name := range layout.Key {
+			joined = append(joined, parts[name])
+		}
+		converted = append(converted, strings.Join(joined, "|"))
+
+		fields := make(map[string]string, len(layout.Config))
+		for field, name := range layout.Config {
+			if parts[name] != "" {
+				fields[field] = parts[name]
+			}
 		}
-		oldVal = valInt
+		if configFields == nil {
+			configFields = fields
+			continue
+		}
+		for field := range layout.Config {
+			if fields[field] != configFields[field] {
+				return key, nil, fmt.Errorf("第 %d 个密钥的 %s 与第 1 个不同，config 只能保存一个", i+1, field)
+			}
+		}
+	}
+	return strings.Join(converted, "\n"), configFields, nil
+}
+
+// channelFallback is how a channel whose Source type has no Target equivalent is migrated
+type channelFallback string
+
+const (
+	// fallbackOpenAICompatible migrates the channel as an OpenAI compatible channel, keeping base_url
+	fallbackOpenAICompatible channelFallback = "openai_compatible"
+	// fallbackProxy migrates the channel as a proxy channel, keeping base_url
+	fallbackProxy channelFallback = "proxy"
+	// fallbackAwsClaude migrates the channel as AWS Claude (Bedrock)
+	fallbackAwsClaude channelFallback = "aws_claude"
+	// fallbackDisable keeps the channel with an unknown type, disabled and tagged in its name
+	fallbackDisable channelFallback = "disable"
+	// fallbackSkip does not migrate the channel
+	fallbackSkip channelFallback = "skip"
+)
+
+// TargetChannelStatusManuallyDisabled is one-api's status for a manually disabled channel
+const TargetChannelStatusManuallyDisabled = 2
+
+// Built-in fallbacks for Source types missing from channelMap; other unmapped types use channelFallbacks.Default
+var defaultChannelFallbacks = map[int]channelFallback{
+	SourceChannelTypeBedrock:         fallbackAwsClaude,
+	SourceChannelTypeGithub:          fallbackOpenAICompatible,
+	SourceChannelTypeAzureV1:         fallbackOpenAICompatible,
+	SourceChannelTypeAzureDatabricks: fallbackOpenAICompatible,
+	SourceChannelTypeLLAMA:           fallbackOpenAICompatible,
+	SourceChannelTypeHunyuan:         fallbackOpenAICompatible,
+	SourceChannelTypeJina:            fallbackOpenAICompatible,
+}
+
+func parseChannelFallback(s string) (channelFallback, error) {
+	switch f := channelFallback(strings.ToLower(strings.TrimSpace(s))); f {
+	case fallbackOpenAICompatible, fallbackProxy, fallbackAwsClaude, fallbackDisable, fallbackSkip:
+		return f, nil
 	default:
-		fmt.Printf("渠道Type旧值: 非整数或字节数组, 新值: %d (未知类型)\n", TargetChannelTypeUnknown)
-		return TargetChannelTypeUnknown
+		return "", fmt.Errorf("未知的渠道类型兜底策略 %q（可选 openai_compatible/proxy/aws_claude/disable/skip）", s)
 	}
+}
+
+// channelFallbacks is the fallback for unmapped Source types: per-type overrides, then built-ins, then Default
+type channelFallbacks struct {
+	Default channelFallback
+	PerType map[int]channelFallback
+}
 
-	if newVal, found := channelMap[oldVal]; found {
-		fmt.Printf("渠道Type旧值: %d, 新值: %d\n", oldVal, newVal)
-		return newVal
+// parseChannelFallbacks parses "disable" or "disable,34=skip,49=openai_compatible":
+// a bare item sets the default for unmapped types without a built-in fallback, type=fallback overrides one Source type
+func parseChannelFallbacks(s string) (channelFallbacks, error) {
+	fallbacks := channelFallbacks{Default: fallbackDisable, PerType: make(map[int]channelFallback)}
+	for _, item := range splitCSVTrim(s) {
+		typ, value, perType := strings.Cut(item, "=")
+		if !perType {
+			f, err := parseChannelFallback(item)
+			if err != nil {
+				return fallbacks, err
+			}
+			fallbacks.Default = f
+			continue
+		}
+		t, err := strconv.Atoi(strings.TrimSpace(typ))
+		if err != nil {
+			return fallbacks, fmt.Errorf("渠道类型兜底策略 %q 中的类型不是整数", item)
+		}
+		f, err := parseChannelFallback(value)
+		if err != nil {
+			return fallbacks, err
+		}
+		fallbacks.PerType[t] = f
+	}
+	return fallbacks, nil
+}
+
+func (c channelFallbacks) forType(sourceType int) channelFallback {
+	if f, ok := c.PerType[sourceType]; ok {
+		return f
+	}
+	if f, ok := defaultChannelFallbacks[sourceType]; ok {
+		return f
+	}
+	if c.Default == "" {
+		return fallbackDisable
+	}
+	return c.Default
+}
+
+// channelDecision is how a single Source channel is migrated
+type channelDecision struct {
+	SourceType int
+	Type       int
+	// Fallback is empty when the Source type maps directly through channelMap
+	Fallback channelFallback
+	Disable  bool
+	Skip     bool
+	// Reason explains a fallback that could not be applied as configured
+	Reason string
+}
+
+// decideChannel maps a Source channel type value, applying the configured fallback when channelMap has no entry
+func decideChannel(oldValue interface{}, baseURL string) channelDecision {
+	oldVal, newVal, found, err := mapChannelType(oldValue)
+	if err == nil && found {
+		return channelDecision{SourceType: oldVal, Type: newVal}
 	}
-	fmt.Printf("渠道Type旧值: %d, 新值未找到, 返回默认值: %d (未知类型)\n", oldVal, TargetChannelTypeUnknown)
-	return TargetChannelTypeUnknown
+	d := channelDecision{SourceType: oldVal, Type: TargetChannelTypeUnknown, Fallback: config.ChannelFallback.forType(oldVal)}
+	switch d.Fallback {
+	case fallbackOpenAICompatible, fallbackProxy:
+		d.Type = TargetChannelTypeOpenAICompatible
+		if d.Fallback == fallbackProxy {
+			d.Type = TargetChannelTypeProxy
+		}
+		if strings.TrimSpace(baseURL) == "" {
+			d.Disable = true
+			d.Reason = "base_url 为空"
+		}
+	case fallbackAwsClaude:
+		d.Type = TargetChannelTypeAwsClaude
+	case fallbackSkip:
+		d.Skip = true
+	default:
+		d.Disable = true
+	}
+	return d
+}
+
+// label describes the decision for the per-channel summary
+func (d channelDecision) label() string {
+	var label string
+	switch d.Fallback {
+	case "":
+		return ""
+	case fallbackSkip:
+		return "跳过（不迁移）"
+	case fallbackDisable:
+		label = fmt.Sprintf("禁用并标记（类型 %d）", d.Type)
+	default:
+		label = fmt.Sprintf("按 %s 迁移（类型 %d）", d.Fallback, d.Type)
+	}
+	if d.Reason != "" {
+		label += fmt.Sprintf("，%s，已禁用", d.Reason)
+	}
+	return label
+}
+
+// disabledChannelName tags the name of a channel disabled by its fallback
+func disabledChannelName(sourceType int, name string) string {
+	return fmt.Sprintf("[one-hub 类型 %d] %s", sourceType, name)
 }
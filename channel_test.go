@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitChannelKey(t *testing.T) {
+	bedrock := channelKeyLayouts[SourceChannelTypeBedrock]
+	tests := []struct {
+		name    string
+		layout  channelKeyLayout
+		key     string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:   "按段命名并去掉空白",
+			layout: bedrock,
+			key:    "us-east-1| AKID |SECRET",
+			want:   map[string]string{"region": "us-east-1", "ak": "AKID", "sk": "SECRET"},
+		},
+		{
+			name:   "可选段为空",
+			layout: bedrock,
+			key:    "us-east-1|AKID|SECRET|",
+			want:   map[string]string{"region": "us-east-1", "ak": "AKID", "sk": "SECRET", "session_token": ""},
+		},
+		{name: "段数不足", layout: bedrock, key: "us-east-1|AKID", wantErr: "实际为 2 段"},
+		{name: "段数过多", layout: bedrock, key: "a|b|c|d|e", wantErr: "实际为 5 段"},
+		{name: "必填段为空", layout: bedrock, key: "us-east-1||SECRET", wantErr: "其中 ak 为空"},
+		{name: "one-api 无处保存的段", layout: bedrock, key: "us-east-1|AKID|SECRET|TOKEN", wantErr: "session_token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitChannelKey(tt.layout, tt.key)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("splitChannelKey(%q) error = %v, want 包含 %q", tt.key, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitChannelKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradeChannelKey(t *testing.T) {
+	adc := "{\n  \"type\": \"service_account\"\n}"
+	tests := []struct {
+		name       string
+		sourceType int
+		// fallback 非空时按该兜底策略决定渠道的目标类型，否则按 channelMap 映射
+		fallback   string
+		key        string
+		want       string
+		wantConfig map[string]string
+		wantErr    string
+	}{
+		{name: "没有布局的类型原样保留", sourceType: SourceChannelTypeOpenAI, key: "sk-a|b", want: "sk-a|b"},
+		{name: "空密钥", sourceType: SourceChannelTypeBedrock, key: "", want: ""},
+		{
+			name: "Bedrock 重排", sourceType: SourceChannelTypeBedrock, key: "us-east-1|AKID|SECRET",
+			want:       "AKID|SECRET|us-east-1",
+			wantConfig: map[string]string{"region": "us-east-1", "ak": "AKID", "sk": "SECRET"},
+		},
+		{
+			name: "Bedrock 兜底为 disable 时保留原密钥", sourceType: SourceChannelTypeBedrock, fallback: "32=disable",
+			key: "us-east-1|AKID|SECRET", want: "us-east-1|AKID|SECRET",
+		},
+		{
+			name: "Bedrock 兜底为 proxy 时保留原密钥", sourceType: SourceChannelTypeBedrock, fallback: "32=proxy",
+			key: "us-east-1|AKID|SECRET", want: "us-east-1|AKID|SECRET",
+		},
+		{
+			name: "Bedrock 带 session token", sourceType: SourceChannelTypeBedrock, key: "us-east-1|AKID|SECRET|TOKEN",
+			want: "us-east-1|AKID|SECRET|TOKEN", wantErr: "session_token",
+		},
+		{
+			name: "Cloudflare 账号写入 config", sourceType: SourceChannelTypeCloudflareAI, key: "acct|tok",
+			want: "tok", wantConfig: map[string]string{"user_id": "acct"},
+		},
+		{
+			name: "Vertex AI 的 adc 可以跨行", sourceType: SourceChannelTypeVertexAI, key: "us-central1|proj|" + adc,
+			want:       "us-central1|proj|" + adc,
+			wantConfig: map[string]string{"region": "us-central1", "vertex_ai_project_id": "proj", "vertex_ai_adc": adc},
+		},
+		{
+			name: "百度多个密钥逐行转换", sourceType: SourceChannelTypeBaidu, key: "k1|s1\r\n\nk2|s2\n",
+			want: "k1|s1\nk2|s2", wantConfig: map[string]string{},
+		},
+		{
+			name: "多个密钥中有一个格式不符", sourceType: SourceChannelTypeBaidu, key: "k1|s1\nk2",
+			want: "k1|s1\nk2", wantErr: "第 2 个密钥",
+		},
+		{
+			name: "多个密钥的 config 字段相同", sourceType: SourceChannelTypeCloudflareAI, key: "acct|t1\nacct|t2",
+			want: "t1\nt2", wantConfig: map[string]string{"user_id": "acct"},
+		},
+		{
+			name: "多个密钥的 config 字段不同", sourceType: SourceChannelTypeBedrock, key: "us-east-1|A1|S1\nus-east-1|A2|S2",
+			want: "us-east-1|A1|S1\nus-east-1|A2|S2", wantErr: "config 只能保存一个",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fallbacks, err := parseChannelFallbacks(tt.fallback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config = Config{ChannelFallback: fallbacks}
+			defer func() { config = Config{} }()
+			d := decideChannel(tt.sourceType, "")
+
+			got, cfg, err := upgradeChannelKey(d.SourceType, d.Type, tt.key)
+			if got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want 包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, tt.wantConfig) {
+				t.Errorf("config = %v, want %v", cfg, tt.wantConfig)
+			}
+		})
+	}
+}
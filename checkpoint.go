@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCheckpointFile 是断点文件的默认路径
+	defaultCheckpointFile = "db-transfer-checkpoint.json"
+	// defaultChunkSize 是可续传的表每次提交事务的行数
+	defaultChunkSize = 10000
+)
+
+// checkpoint 记录每张表已迁移到的主键位置，保存在本地 JSON 文件中，重跑时从断点继续
+type checkpoint struct {
+	path string
+	mu   sync.Mutex
+
+	// Source/Target 是源库与目标库连接串的指纹，防止把断点用到另一组数据库上
+	Source string                      `json:"source"`
+	Target string                      `json:"target"`
+	Tables map[string]*tableCheckpoint `json:"tables"`
+	// IDOffsets 是合并模式下各目标表的 id 偏移量，续传时必须沿用
+	IDOffsets map[string]int64 `json:"id_offsets,omitempty"`
+	// UsersChecked 表示已检测过用户冲突，续传时沿用 UserCollisions，避免把已迁移的用户当成冲突、重复合并额度
+	UsersChecked   bool            `json:"users_checked,omitempty"`
+	UserCollisions []userCollision `json:"user_collisions,omitempty"`
+}
+
+type tableCheckpoint struct {
+	// LastID 是已提交的最大 id，续传时从 id > LastID 开始读取
+	LastID    int64  `json:"last_id"`
+	Rows      int64  `json:"rows"`
+	Done      bool   `json:"done"`
+	UpdatedAt string `json:"updated_at"`
+	// Ranges 非空时表按 id 区间并发迁移，每个区间单独记录进度，LastID 不再使用
+	Ranges []rangeCheckpoint `json:"ranges,omitempty"`
+	// RolledUp 表示 --logs-rollup-before 之前的日志已汇总写入
+	RolledUp bool `json:"rolled_up,omitempty"`
+}
+
+// rangeCheckpoint 是一个 id 区间 (LastID, To] 的进度，To 为 0 表示不设上界
+type rangeCheckpoint struct {
+	LastID int64 `json:"last_id"`
+	To     int64 `json:"to"`
+	Rows   int64 `json:"rows"`
+	Done   bool  `json:"done"`
+}
+
+// rangesDone 表示所有区间都已完成
+func (t *tableCheckpoint) rangesDone() bool {
+	for _, r := range t.Ranges {
+		if !r.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// loadCheckpoint 读取断点文件；restart 为 true 时丢弃已有断点
+func loadCheckpoint(path string, restart bool) (*checkpoint, error) {
+	cp := &checkpoint{
+		path:   path,
+		Source: dsnFingerprint(config.OldDSN),
+		Target: dsnFingerprint(config.NewDSN),
+		Tables: make(map[string]*tableCheckpoint),
+	}
+	if path == "" {
+		return cp, nil
+	}
+	if restart {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("删除断点文件失败: %w", err)
+		}
+		return cp, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取断点文件失败: %w", err)
+	}
+
+	var saved checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("解析断点文件 %s 失败: %w", path, err)
+	}
+	if saved.Source != cp.Source || saved.Target != cp.Target {
+		return nil, fmt.Errorf("断点文件 %s 属于另一组源库/目标库，请使用 --restart 丢弃或指定其他 --checkpoint", path)
+	}
+	if saved.Tables != nil {
+		cp.Tables = saved.Tables
+	}
+	cp.IDOffsets = saved.IDOffsets
+	cp.UsersChecked = saved.UsersChecked
+	cp.UserCollisions = saved.UserCollisions
+	return cp, nil
+}
+
+// table 返回表的断点副本，不存在时返回零值
+func (c *checkpoint) table(name string) tableCheckpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.Tables[name]; ok {
+		copied := *t
+		copied.Ranges = append([]rangeCheckpoint(nil), t.Ranges...)
+		return copied
+	}
+	return tableCheckpoint{}
+}
+
+// update 修改表的断点并立即写入文件
+func (c *checkpoint) update(name string, fn func(t *tableCheckpoint)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.Tables[name]
+	if !ok {
+		t = &tableCheckpoint{}
+		c.Tables[name] = t
+	}
+	fn(t)
+	t.UpdatedAt = time.Now().Format(time.RFC3339)
+	return c.saveLocked()
+}
+
+// setIDOffsets 记录合并模式的 id 偏移量并立即写入文件
+func (c *checkpoint) setIDOffsets(offsets map[string]int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.IDOffsets = offsets
+	return c.saveLocked()
+}
+
+// setUserCollisions 记录用户冲突的检测结果并立即写入文件
+func (c *checkpoint) setUserCollisions(collisions []userCollision) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.UsersChecked = true
+	c.UserCollisions = collisions
+	return c.saveLocked()
+}
+
+// remove 删除断点文件，在全部表迁移成功后调用
+func (c *checkpoint) remove() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == "" {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (c *checkpoint) saveLocked() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免进程中断时留下半个文件
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// dsnFingerprint 返回连接串的摘要，断点文件中不保存明文密码
+func dsnFingerprint(dsn string) string {
+	driver, normalized := detectDriver(dsn)
+	sum := sha256.Sum256([]byte(driver + "|" + normalized))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command 是一个子命令
+type command struct {
+	Name    string
+	Summary string
+	// Args 描述位置参数，用于帮助信息
+	Args string
+	// needSource 为 false 时不需要源库连接串（如 rebuild-abilities）
+	needSource bool
+	run        func() int
+}
+
+var commands = []*command{
+	{Name: "migrate", Summary: "迁移数据（默认子命令，不写子命令时等同于 migrate）", Args: "[源DSN 目标DSN]", needSource: true, run: runMigrate},
+	{Name: "plan", Summary: "只读取两端数据库并输出迁移计划，不写入目标库（等同于 migrate --dry-run）", Args: "[源DSN 目标DSN]", needSource: true, run: runPlan},
+	{Name: "verify", Summary: "比较源库与目标库的行数、id 范围和逐行校验和（等同于 migrate --verify-only）", Args: "[源DSN 目标DSN]", needSource: true, run: runVerify},
+	{Name: "rebuild-abilities", Summary: "从目标库 channels 重建 abilities", Args: "[目标DSN]", run: runRebuildAbilities},
+	{Name: "reset-sequences", Summary: "把目标库各表的自增序列调整到 max(id)+1", Args: "[目标DSN]", run: runResetSequences},
+	{Name: "restore", Summary: "把目标库恢复为 migrate --backup-dir 生成的备份", Args: "[目标DSN]", run: runRestore},
+	{Name: "inspect", Summary: "查看两端数据库的版本、各表行数与字段差异、源库渠道类型分布", Args: "[源DSN 目标DSN]", needSource: true, run: runInspect},
+}
+
+// cliOptions 是需要解析后才能写入 config 的原始参数
+type cliOptions struct {
+	conflict        string
+	channelFallback string
+	tables          string
+	dumpMapping     bool
+	// allowNonEmpty/truncateTarget/appendRows 合成 config.TargetMode
+	allowNonEmpty  bool
+	truncateTarget bool
+	appendRows     bool
+	merge          bool
+	idOffsets      string
+	backupFormat   string
+	userCollision  string
+	optionsPolicy  string
+	logsSince      string
+	logsUntil      string
+	logsRollup     string
+	// restoreFrom 是 restore 读取的备份目录
+	restoreFrom string
+}
+
+var options = cliOptions{conflict: string(conflictIgnore), channelFallback: string(fallbackDisable), backupFormat: backupFormatJSONL, userCollision: collisionSkip, optionsPolicy: optionsKeep}
+
+// parseCommand 从命令行参数中取出子命令；第一个参数不是子命令时按 migrate 处理，兼容旧的 `db-transfer 源DSN 目标DSN` 用法
+func parseCommand(args []string) (*command, []string) {
+	if len(args) > 0 {
+		for _, cmd := range commands {
+			if args[0] == cmd.Name {
+				return cmd, args[1:]
+			}
+		}
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			printUsage()
+			os.Exit(0)
+		}
+	}
+	return commands[0], args
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "用法: %s <子命令> [参数] [连接串]\n\n子命令:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-18s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintf(out, "\n使用 `%s <子命令> --help` 查看子命令的参数。所有参数都可以用括号中的 ONEAPI_* 环境变量设置，命令行参数优先。\n", os.Args[0])
+	fmt.Fprintln(out, "连接串也可以通过 --source/--target 或环境变量 ONEAPI_SOURCE_SQL_DSN/ONEAPI_TARGET_SQL_DSN 指定。")
+}
+
+// newFlagSet 注册子命令可用的参数，默认值取自对应的 ONEAPI_* 环境变量
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "用法: %s %s [参数] %s\n\n%s\n\n参数:\n", os.Args[0], cmd.Name, cmd.Args, cmd.Summary)
+		fs.PrintDefaults()
+	}
+	is := func(names ...string) bool {
+		for _, name := range names {
+			if cmd.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 连接串与迁移规则，所有子命令通用
+	if cmd.needSource {
+		fs.StringVar(&config.OldDSN, "source", stringEnv("ONEAPI_SOURCE_SQL_DSN", ""), "MartialBE/one-hub 数据库的连接串（源，环境变量 ONEAPI_SOURCE_SQL_DSN）")
+	}
+	fs.StringVar(&config.NewDSN, "target", stringEnv("ONEAPI_TARGET_SQL_DSN", ""), "songquanpeng/one-api 数据库的连接串（目标，环境变量 ONEAPI_TARGET_SQL_DSN）")
+	fs.StringVar(&config.LogFormat, "log-format", stringEnv("ONEAPI_LOG_FORMAT", logFormatText), "日志格式 text/json，json 时 stdout 每行一个事件、其余提示输出到 stderr（环境变量 ONEAPI_LOG_FORMAT）")
+	fs.StringVar(&config.MappingFile, "mapping", stringEnv("ONEAPI_MAPPING_FILE", ""), "JSON 或 YAML（.yaml/.yml）格式的迁移规则文件，默认使用内置规则（环境变量 ONEAPI_MAPPING_FILE）")
+	fs.BoolVar(&options.dumpMapping, "dump-mapping", false, "输出当前生效的迁移规则（JSON）后退出，可作为 --mapping 文件的模板")
+	if is("migrate", "plan", "rebuild-abilities") {
+		fs.StringVar(&options.conflict, "conflict", stringEnv("ONEAPI_CONFLICT_POLICY", string(conflictIgnore)), "主键冲突策略 ignore/upsert/error，可按表覆盖，如 ignore,users=upsert（环境变量 ONEAPI_CONFLICT_POLICY）")
+	}
+	if is("migrate", "plan", "verify", "inspect") {
+		fs.StringVar(&options.tables, "tables", stringEnv("ONEAPI_TABLES", ""), "只处理这些表（逗号分隔，使用迁移规则中的表名），默认全部（环境变量 ONEAPI_TABLES）")
+		fs.StringVar(&options.channelFallback, "channel-fallback", stringEnv("ONEAPI_CHANNEL_FALLBACK", string(fallbackDisable)), "没有对应类型的渠道的兜底策略 openai_compatible/proxy/aws_claude/disable/skip，可按源类型覆盖，如 disable,34=skip（环境变量 ONEAPI_CHANNEL_FALLBACK）")
+		fs.Var(config.ChannelTypes, "channel-type", "扩展或覆盖渠道类型映射，格式 源类型=目标类型，可重复，如 --channel-type 60=50（环境变量 ONEAPI_CHANNEL_TYPES，逗号分隔）")
+	}
+
+	if is("migrate") {
+		fs.BoolVar(&config.DryRun, "dry-run", boolEnv("ONEAPI_DRY_RUN", false), "只输出迁移计划，不写入目标库（环境变量 ONEAPI_DRY_RUN）")
+		fs.BoolVar(&config.VerifyOnly, "verify-only", boolEnv("ONEAPI_VERIFY_ONLY", false), "不迁移，只执行校验（环境变量 ONEAPI_VERIFY_ONLY）")
+		fs.IntVar(&config.BatchSize, "batch-size", intEnv("ONEAPI_BATCH_SIZE", defaultBatchSize), "单条 INSERT 批量写入的行数（环境变量 ONEAPI_BATCH_SIZE）")
+		fs.IntVar(&config.ChunkSize, "chunk-size", intEnv("ONEAPI_CHUNK_SIZE", defaultChunkSize), "按 id 顺序迁移时每次提交事务的行数（环境变量 ONEAPI_CHUNK_SIZE）")
+		fs.BoolVar(&config.Verify, "verify", boolEnv("ONEAPI_VERIFY", false), "迁移结束后校验源库与目标库的行数、id 范围和逐行校验和（环境变量 ONEAPI_VERIFY）")
+		fs.BoolVar(&config.FailFast, "fail-fast", boolEnv("ONEAPI_FAIL_FAST", false), "第一张表失败后停止迁移其余表，进行中的表在下一个 chunk 提交后停止（环境变量 ONEAPI_FAIL_FAST）")
+		fs.IntVar(&config.Workers, "workers", intEnv("ONEAPI_WORKERS", 1), "并发迁移的 worker 数，大于 1 时多张表同时迁移、大表按 id 区间拆分（SQLite 目标库固定为 1，环境变量 ONEAPI_WORKERS）")
+		fs.StringVar(&config.BackupDir, "backup-dir", stringEnv("ONEAPI_BACKUP_DIR", ""), "写入目标库前把涉及的表备份到该目录下的新子目录（环境变量 ONEAPI_BACKUP_DIR）")
+		fs.StringVar(&options.backupFormat, "backup-format", stringEnv("ONEAPI_BACKUP_FORMAT", backupFormatJSONL), "备份格式 jsonl/sql，jsonl 可恢复到任意数据库（环境变量 ONEAPI_BACKUP_FORMAT）")
+		fs.BoolVar(&config.ResetSequences, "reset-sequences", boolEnv("ONEAPI_RESET_SEQUENCES", true), "迁移结束后把目标库各表的自增序列（Postgres 序列、MySQL AUTO_INCREMENT、SQLite sqlite_sequence）调整到 max(id)+1（环境变量 ONEAPI_RESET_SEQUENCES）")
+		fs.StringVar(&config.SummaryFile, "summary-file", stringEnv("ONEAPI_SUMMARY_FILE", ""), "把 JSON 格式的运行汇总写入该文件（环境变量 ONEAPI_SUMMARY_FILE）")
+	}
+	if is("migrate", "restore") {
+		fs.BoolVar(&config.AssumeYes, "yes", boolEnv("ONEAPI_YES", false), "--truncate-target 或 restore 清空目标库表时不再询问确认（环境变量 ONEAPI_YES）")
+	}
+	if is("migrate", "plan", "verify") {
+		fs.BoolVar(&config.SkipLogs, "skip-logs", boolEnv("ONEAPI_SKIP_LOGS", false), "不迁移（校验）logs 表（环境变量 ONEAPI_SKIP_LOGS）")
+		fs.StringVar(&options.logsSince, "logs-since", stringEnv("ONEAPI_LOGS_SINCE", ""), "只迁移（校验）created_at 不早于该时间的日志，如 2024-01-01、\"2024-01-01 08:00:00\" 或 90d（最近 90 天，环境变量 ONEAPI_LOGS_SINCE）")
+		fs.StringVar(&options.logsRollup, "logs-rollup-before", stringEnv("ONEAPI_LOGS_ROLLUP_BEFORE", ""), "早于该时间的消费日志汇总为每个用户、模型每天一行（额度与 token 数求和），之后的日志逐行复制，格式同 --logs-since（环境变量 ONEAPI_LOGS_ROLLUP_BEFORE）")
+		fs.StringVar(&options.logsUntil, "logs-until", stringEnv("ONEAPI_LOGS_UNTIL", ""), "只迁移（校验）created_at 早于该时间的日志，只写日期时包含当天（环境变量 ONEAPI_LOGS_UNTIL）")
+		fs.StringVar(&options.optionsPolicy, "options-policy", stringEnv("ONEAPI_OPTIONS_POLICY", optionsKeep), "目标库已设置的配置项（含 ModelRatio/GroupRatio 中的同名条目）keep 保留、overwrite 用源库的值覆盖，校验时 keep 保留的配置项不算不一致（环境变量 ONEAPI_OPTIONS_POLICY）")
+	}
+	if is("migrate", "verify") {
+		fs.StringVar(&config.IDMapFile, "id-map-file", stringEnv("ONEAPI_ID_MAP_FILE", defaultIDMapFile), "合并模式或有用户冲突时导出（migrate）、校验时读取（verify）源库 id 与目标库 id 对照的 CSV 文件（环境变量 ONEAPI_ID_MAP_FILE）")
+	}
+	if is("verify") {
+		fs.BoolVar(&options.merge, "merge", boolEnv("ONEAPI_MERGE", false), "校验合并模式迁移的结果，按 --id-map-file 中的 id 对照比较（环境变量 ONEAPI_MERGE）")
+	}
+	if is("restore") {
+		fs.StringVar(&options.restoreFrom, "from", stringEnv("ONEAPI_RESTORE_FROM", ""), "备份目录（包含 manifest.json，环境变量 ONEAPI_RESTORE_FROM）")
+	}
+	if is("migrate", "plan") {
+		fs.StringVar(&config.CheckpointFile, "checkpoint", stringEnv("ONEAPI_CHECKPOINT_FILE", defaultCheckpointFile), "断点文件路径，为空时不记录断点（环境变量 ONEAPI_CHECKPOINT_FILE）")
+		fs.BoolVar(&config.Restart, "restart", boolEnv("ONEAPI_RESTART", false), "丢弃已有断点，从头迁移（环境变量 ONEAPI_RESTART）")
+		fs.BoolVar(&config.SkipPreflight, "skip-preflight", boolEnv("ONEAPI_SKIP_PREFLIGHT", false), "跳过迁移前的预检（同库检测、表是否存在、目标库写入权限，环境变量 ONEAPI_SKIP_PREFLIGHT）")
+		fs.BoolVar(&options.allowNonEmpty, "allow-non-empty", boolEnv("ONEAPI_ALLOW_NON_EMPTY", false), "目标库表已有数据时照常迁移，冲突按 --conflict 处理（环境变量 ONEAPI_ALLOW_NON_EMPTY）")
+		fs.BoolVar(&options.truncateTarget, "truncate-target", boolEnv("ONEAPI_TRUNCATE_TARGET", false), "迁移前清空目标库中已有数据的表，需要确认（环境变量 ONEAPI_TRUNCATE_TARGET）")
+		fs.BoolVar(&options.merge, "merge", boolEnv("ONEAPI_MERGE", false), "合并进已有数据的目标库：users/channels/tokens/redemptions/logs 按偏移量分配新 id 并改写引用（环境变量 ONEAPI_MERGE）")
+		fs.StringVar(&options.idOffsets, "id-offset", stringEnv("ONEAPI_ID_OFFSETS", ""), "合并模式下指定表的 id 偏移量，默认为目标库当前最大 id，如 users=10000,channels=500（环境变量 ONEAPI_ID_OFFSETS）")
+		fs.StringVar(&options.userCollision, "user-collision", stringEnv("ONEAPI_USER_COLLISION", collisionSkip), "源库用户的 username/email/github_id/access_token 与目标库已有用户相同时的处理方式：skip 不迁移、merge 合并额度、rename 改名迁移；skip/merge 时令牌与日志归入目标库用户（环境变量 ONEAPI_USER_COLLISION）")
+		fs.StringVar(&config.UserRenameSuffix, "user-rename-suffix", stringEnv("ONEAPI_USER_RENAME_SUFFIX", defaultRenameSuffix), "--user-collision rename 时追加到用户名后的后缀（环境变量 ONEAPI_USER_RENAME_SUFFIX）")
+		fs.BoolVar(&config.RemergeQuotas, "remerge-quotas", boolEnv("ONEAPI_REMERGE_QUOTAS", false), "--user-collision merge 时，目标库中已记录合并过的用户仍再次累加额度（环境变量 ONEAPI_REMERGE_QUOTAS）")
+		fs.BoolVar(&options.appendRows, "append", boolEnv("ONEAPI_APPEND", false), "目标库表已有数据时只迁移 id 大于目标库最大 id 的行（环境变量 ONEAPI_APPEND）")
+		fs.BoolVar(&config.MigratePrices, "migrate-prices", boolEnv("ONEAPI_MIGRATE_PRICES", true), "把 one-hub 的 prices 表转换为目标库 options 中的 ModelRatio/CompletionRatio，与已有配置合并（环境变量 ONEAPI_MIGRATE_PRICES）")
+		fs.BoolVar(&config.MigrateGroups, "migrate-groups", boolEnv("ONEAPI_MIGRATE_GROUPS", true), "把 one-hub 的 user_groups 表转换为目标库 options 中的 GroupRatio，并检查用户、渠道、abilities 引用的分组都存在（环境变量 ONEAPI_MIGRATE_GROUPS）")
+		fs.BoolVar(&config.RebuildAbilities, "rebuild-abilities", boolEnv("ONEAPI_REBUILD_ABILITIES", true), "迁移结束后从目标库 channels 重建 abilities（环境变量 ONEAPI_REBUILD_ABILITIES）")
+	}
+	return fs
+}
+
+// setupConfig 解析需要校验的参数并加载迁移规则
+func setupConfig() error {
+	var err error
+	if config.Conflict, err = parseConflictPolicies(options.conflict); err != nil {
+		return err
+	}
+	if config.ChannelFallback, err = parseChannelFallbacks(options.channelFallback); err != nil {
+		return err
+	}
+	if config.OptionsPolicy, err = parseOptionsPolicy(options.optionsPolicy); err != nil {
+		return err
+	}
+	config.Conflict = effectiveOptionsConflict(config.Conflict, config.OptionsPolicy)
+	if config.TargetMode, err = parseTargetMode(options.allowNonEmpty, options.truncateTarget, options.appendRows, options.merge); err != nil {
+		return err
+	}
+	if config.IDOffsets, err = parseIDOffsets(options.idOffsets); err != nil {
+		return err
+	}
+	if config.BackupFormat, err = parseBackupFormat(options.backupFormat); err != nil {
+		return err
+	}
+	if config.UserCollision, err = parseUserCollision(options.userCollision); err != nil {
+		return err
+	}
+	if config.LogsSince, config.LogsUntil, err = parseLogsWindow(options.logsSince, options.logsUntil); err != nil {
+		return err
+	}
+	if config.LogsRollupBefore, err = parseLogsTime(options.logsRollup, false); err != nil {
+		return fmt.Errorf("--logs-rollup-before: %w", err)
+	}
+	if mapping, err = loadMapping(config.MappingFile); err != nil {
+		return err
+	}
+	if err := mapping.selectTables(splitCSVTrim(options.tables)); err != nil {
+		return err
+	}
+	if config.SkipLogs {
+		return mapping.excludeTarget("logs")
+	}
+	return nil
+}
+
+// resolveDSNs 用位置参数覆盖 --source/--target，缺少连接串时返回错误
+func resolveDSNs(cmd *command, args []string) error {
+	switch {
+	case len(args) == 0:
+	case cmd.needSource && len(args) == 2:
+		config.OldDSN, config.NewDSN = args[0], args[1]
+	case !cmd.needSource && len(args) == 1:
+		config.NewDSN = args[0]
+	default:
+		return fmt.Errorf("%s 的位置参数应为 %s，实际为 %d 个: %v", cmd.Name, cmd.Args, len(args), args)
+	}
+	var missing []string
+	if cmd.needSource && strings.TrimSpace(config.OldDSN) == "" {
+		missing = append(missing, "源库（--source 或 ONEAPI_SOURCE_SQL_DSN）")
+	}
+	if strings.TrimSpace(config.NewDSN) == "" {
+		missing = append(missing, "目标库（--target 或 ONEAPI_TARGET_SQL_DSN）")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("缺少连接串: %s", strings.Join(missing, "、"))
+	}
+	return nil
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 源库用户与目标库已有用户冲突（username/email/github_id/access_token 相同）时的处理方式
+const (
+	// collisionSkip 不迁移该用户，其令牌、日志等归入目标库已有的用户
+	collisionSkip = "skip"
+	// collisionMerge 不迁移该用户，额度、已用额度与请求次数累加到目标库已有的用户，令牌、日志等同样归入该用户
+	collisionMerge = "merge"
+	// collisionRename 照常迁移该用户，用户名冲突时加后缀，其余冲突的列清空
+	collisionRename = "rename"
+)
+
+// defaultRenameSuffix 是 rename 时追加到用户名后的默认后缀
+const defaultRenameSuffix = "_onehub"
+
+// userUniqueColumns 是判断用户冲突的列，按顺序检查，空值不参与比较
+var userUniqueColumns = []string{"username", "email", "github_id", "access_token"}
+
+// userQuotaColumns 是 merge 时累加到目标库用户的列
+var userQuotaColumns = []string{"quota", "used_quota", "request_count"}
+
+// quotaMergeOption 是目标库 options 表中记录已合并额度的配置项：源库连接串摘要:源库用户 id -> 目标库用户 id。
+// 与额度累加在同一个事务中写入，断点文件丢失或 --restart 后重新迁移也不会重复累加
+const quotaMergeOption = "DBTransferMergedQuotas"
+
+// userCollision 是一个与目标库已有用户冲突的源库用户及其处理方式
+type userCollision struct {
+	SourceID int64 `json:"source_id"`
+	// TargetID 是发生冲突的目标库用户，与多个用户冲突时取最先检查的列对应的用户
+	TargetID int64  `json:"target_id"`
+	Policy   string `json:"policy"`
+	// Columns 是与任一目标库用户值相同的列
+	Columns []string `json:"columns"`
+	// OtherTargets 是除 TargetID 外同样发生冲突的目标库用户
+	OtherTargets []int64 `json:"other_targets,omitempty"`
+	// Username 是 rename 后的用户名，用户名没有冲突时为空
+	Username string `json:"username,omitempty"`
+
+	quota []int64
+}
+
+// userCollisions 是源库用户 id -> 冲突处理，没有冲突的用户不在其中
+var userCollisions map[int64]userCollision
+
+func parseUserCollision(s string) (string, error) {
+	switch s = strings.TrimSpace(strings.ToLower(s)); s {
+	case collisionSkip, collisionMerge, collisionRename:
+		return s, nil
+	}
+	return "", fmt.Errorf("无效的用户冲突策略 %q（可选 skip/merge/rename）", s)
+}
+
+// finalID 返回源库用户在目标库中的 id：skip/merge 为目标库已有的用户
+func (c userCollision) finalID() (int64, bool) {
+	if c.Policy == collisionRename {
+		return 0, false
+	}
+	return c.TargetID, true
+}
+
+// setupUserCollisions 检测源库用户与目标库已有用户的冲突并按 --user-collision 决定处理方式。
+// 续传时沿用断点中的结果；apply 为 true 时执行 merge 的额度累加并把结果写入断点
+func setupUserCollisions(oldDB, newDB *sql.DB, cp *checkpoint, apply bool) error {
+	tm, ok := mapping.tableFor("users")
+	if !ok {
+		return nil
+	}
+	var collisions []userCollision
+	if cp != nil && cp.UsersChecked {
+		collisions = cp.UserCollisions
+		if len(collisions) > 0 {
+			fmt.Fprintln(console, "👥 沿用断点中的用户冲突处理结果")
+		}
+	} else {
+		var err error
+		if collisions, err = detectUserCollisions(oldDB, newDB, tm); err != nil {
+			return err
+		}
+		if apply {
+			if err := mergeUserQuotas(newDB, collisions); err != nil {
+				return err
+			}
+			if cp != nil {
+				if err := cp.setUserCollisions(collisions); err != nil {
+					fmt.Fprintf(console, "⚠️ 写入断点文件失败: %v\n", err)
+				}
+			}
+		}
+	}
+	useUserCollisions(collisions)
+	printUserCollisions(collisions)
+	return nil
+}
+
+// useUserCollisions 让冲突处理生效：skip/merge 的用户不写入，引用它们的列改写为目标库已有用户的 id
+func useUserCollisions(collisions []userCollision) {
+	userCollisions = make(map[int64]userCollision, len(collisions))
+	for _, c := range collisions {
+		userCollisions[c.SourceID] = c
+		if id, ok := c.finalID(); ok {
+			if ids == nil {
+				ids = newIDRemap(map[string]int64{})
+			}
+			ids.setOverride("users", c.SourceID, id)
+		}
+	}
+}
+
+// detectUserCollisions 逐个比较源库用户与目标库用户的唯一列。与源库用户迁移后 id 相同的目标库用户
+// 视为同一行（重复迁移），由 --conflict 处理；--append 时只检查会被迁移的用户
+func detectUserCollisions(oldDB, newDB *sql.DB, tm TableMapping) ([]userCollision, error) {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+	if ok, err := tableExists(newDB, newDriver, tm.Target); err != nil || !ok {
+		return nil, err
+	}
+
+	// 目标库：列 -> 值 -> 用户 id
+	existing := make(map[string]map[string]int64, len(userUniqueColumns))
+	usernames := make(map[string]bool)
+	var targetMax int64
+	err := scanUsers(newDB, newDriver, tm.Target, "id", userUniqueColumns, nil, func(id int64, unique []string, _ []int64) {
+		for i, col := range userUniqueColumns {
+			if unique[i] == "" {
+				continue
+			}
+			if existing[col] == nil {
+				existing[col] = make(map[string]int64)
+			}
+			existing[col][unique[i]] = id
+		}
+		usernames[unique[0]] = true
+		targetMax = max(targetMax, id)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取目标库用户失败: %w", err)
+	}
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	var offset int64
+	if ids != nil {
+		offset = ids.Offsets[tm.Target]
+	}
+	sourceCols := make([]string, len(userUniqueColumns))
+	for i, col := range userUniqueColumns {
+		sourceCols[i] = tm.sourceColumnFor(col)
+	}
+	var quotaCols []string
+	if config.UserCollision == collisionMerge {
+		for _, col := range userQuotaColumns {
+			quotaCols = append(quotaCols, tm.sourceColumnFor(col))
+		}
+	}
+
+	var collisions []userCollision
+	var sourceNames []string
+	err = scanUsers(oldDB, oldDriver, tm.Source, tm.sourceColumnFor("id"), sourceCols, quotaCols, func(id int64, unique []string, quota []int64) {
+		sourceNames = append(sourceNames, unique[0])
+		if config.TargetMode == targetAppend && id <= targetMax {
+			return
+		}
+		c := userCollision{SourceID: id, Policy: config.UserCollision, quota: quota}
+		for i, col := range userUniqueColumns {
+			target, ok := existing[col][unique[i]]
+			if unique[i] == "" || !ok || target == id+offset {
+				continue
+			}
+			// 记录所有冲突的列，不论与哪个目标库用户冲突，rename 时才能全部清空
+			c.Columns = append(c.Columns, col)
+			switch {
+			case c.TargetID == 0:
+				c.TargetID = target
+			case target != c.TargetID && !slices.Contains(c.OtherTargets, target):
+				c.OtherTargets = append(c.OtherTargets, target)
+			}
+		}
+		if c.TargetID == 0 {
+			return
+		}
+		if c.Policy == collisionRename && c.renamesUsername() {
+			c.Username = unique[0]
+		}
+		collisions = append(collisions, c)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取源库用户失败: %w", err)
+	}
+
+	// rename 后的用户名不能再与两端已有的用户名重复
+	for _, name := range sourceNames {
+		usernames[name] = true
+	}
+	for i := range collisions {
+		c := &collisions[i]
+		if c.Policy != collisionRename || !c.renamesUsername() {
+			continue
+		}
+		name := c.Username + config.UserRenameSuffix
+		for n := 2; usernames[name]; n++ {
+			name = fmt.Sprintf("%s%s%d", c.Username, config.UserRenameSuffix, n)
+		}
+		usernames[name] = true
+		c.Username = name
+	}
+	return collisions, nil
+}
+
+// renamesUsername 返回 rename 时是否需要改用户名：只有用户名本身冲突时才加后缀
+func (c userCollision) renamesUsername() bool {
+	return contains(c.Columns, "username")
+}
+
+// targets 返回与该用户冲突的所有目标库用户
+func (c userCollision) targets() string {
+	parts := []string{strconv.FormatInt(c.TargetID, 10)}
+	for _, id := range c.OtherTargets {
+		parts = append(parts, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(parts, "、")
+}
+
+// scanUsers 按 id 顺序读取用户表的 id、唯一列（字符串）与额度列（整数），逐行回调 fn
+func scanUsers(db *sql.DB, driver, table, idCol string, uniqueCols, quotaCols []string, fn func(id int64, unique []string, quota []int64)) error {
+	quoted := []string{quoteIdent(driver, idCol)}
+	for _, col := range append(append([]string(nil), uniqueCols...), quotaCols...) {
+		quoted = append(quoted, quoteIdent(driver, col))
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s",
+		strings.Join(quoted, ", "), quoteIdent(driver, table), quoteIdent(driver, idCol)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]any, len(quoted))
+	ptrs := make([]any, len(quoted))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		id, err := toInt64(values[0])
+		if err != nil {
+			return err
+		}
+		unique := make([]string, len(uniqueCols))
+		for i := range uniqueCols {
+			unique[i] = strings.TrimSpace(valueString(values[1+i]))
+		}
+		quota := make([]int64, len(quotaCols))
+		for i := range quotaCols {
+			if v := values[1+len(uniqueCols)+i]; v != nil {
+				if quota[i], err = toInt64(v); err != nil {
+					return err
+				}
+			}
+		}
+		fn(id, unique, quota)
+	}
+	return rows.Err()
+}
+
+// mergeUserQuotas 在一个事务中把 merge 的源库用户的额度累加到目标库已有的用户，并记录到 quotaMergeOption。
+// 已记录过的用户不再累加，除非指定了 --remerge-quotas
+func mergeUserQuotas(newDB *sql.DB, collisions []userCollision) error {
+	newDriver, _ := detectDriver(config.NewDSN)
+	sets := make([]string, len(userQuotaColumns))
+	for i, col := range userQuotaColumns {
+		q := quoteIdent(newDriver, col)
+		sets[i] = fmt.Sprintf("%s = %s + %s", q, q, placeholderAt(newDriver, i+1))
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s = %s", quoteIdent(newDriver, "users"),
+		strings.Join(sets, ", "), quoteIdent(newDriver, "id"), placeholderAt(newDriver, len(userQuotaColumns)+1))
+
+	tx, err := newDB.Begin()
+	if err != nil {
+		return err
+	}
+	raw, _, err := readOption(tx, newDriver, quotaMergeOption)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("读取目标库配置项 %s 失败: %w", quotaMergeOption, err)
+	}
+	recorded := make(map[string]int64)
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &recorded); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("目标库配置项 %s 不是合法的 JSON: %w", quotaMergeOption, err)
+		}
+	}
+	source := dsnFingerprint(config.OldDSN)
+	merged, already := 0, 0
+	for _, c := range collisions {
+		if c.Policy != collisionMerge {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", source, c.SourceID)
+		if _, ok := recorded[key]; ok && !config.RemergeQuotas {
+			already++
+			continue
+		}
+		args := make([]any, 0, len(c.quota)+1)
+		for _, n := range c.quota {
+			args = append(args, n)
+		}
+		if _, err := tx.Exec(query, append(args, c.TargetID)...); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("合并用户 %d 的额度到目标库用户 %d 失败: %w", c.SourceID, c.TargetID, err)
+		}
+		recorded[key] = c.TargetID
+		merged++
+	}
+	if merged > 0 {
+		data, err := json.Marshal(recorded)
+		if err == nil {
+			err = writeOption(tx, newDriver, quotaMergeOption, string(data))
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("写入目标库配置项 %s 失败: %w", quotaMergeOption, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if merged > 0 {
+		fmt.Fprintf(console, "👥 已把 %d 个冲突用户的额度累加到目标库已有的用户\n", merged)
+	}
+	if already > 0 {
+		fmt.Fprintf(console, "⚠️ %d 个冲突用户的额度已在之前的迁移中累加过（记录在目标库配置项 %s 中），不再重复累加；确需再次累加请使用 --remerge-quotas\n",
+			already, quotaMergeOption)
+	}
+	return nil
+}
+
+func printUserCollisions(collisions []userCollision) {
+	if len(collisions) == 0 {
+		return
+	}
+	fmt.Fprintf(console, "👥 %d 个源库用户与目标库已有用户冲突\n", len(collisions))
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i].SourceID < collisions[j].SourceID })
+	multi := 0
+	for _, c := range collisions {
+		fields := eventFields{"source_id": c.SourceID, "target_id": c.TargetID, "policy": c.Policy, "columns": c.Columns}
+		with := fmt.Sprintf("与目标库用户 %d 的", c.TargetID)
+		if len(c.OtherTargets) > 0 {
+			// 与多个目标库用户冲突：skip/merge 只能归入其中一个，单独列出以便人工核对
+			multi++
+			fields["other_targets"] = c.OtherTargets
+			with = fmt.Sprintf("同时与多个目标库用户（%s）的", c.targets())
+		}
+		switch {
+		case c.Policy == collisionRename && c.Username != "":
+			fields["username"] = c.Username
+			logEvent("user_collision", fields, "   用户 %d %s %s 相同，改名为 %s 迁移\n",
+				c.SourceID, with, strings.Join(c.Columns, "/"), c.Username)
+		case c.Policy == collisionRename:
+			logEvent("user_collision", fields, "   用户 %d %s %s 相同，清空这些列后迁移\n",
+				c.SourceID, with, strings.Join(c.Columns, "/"))
+		case c.Policy == collisionMerge:
+			logEvent("user_collision", fields, "   用户 %d %s %s 相同，额度合并到目标库用户 %d，令牌与日志归入该用户\n",
+				c.SourceID, with, strings.Join(c.Columns, "/"), c.TargetID)
+		default:
+			logEvent("user_collision", fields, "   用户 %d %s %s 相同，不迁移，令牌与日志归入目标库用户 %d\n",
+				c.SourceID, with, strings.Join(c.Columns, "/"), c.TargetID)
+		}
+	}
+	if multi > 0 {
+		fmt.Fprintf(console, "   ⚠️ 其中 %d 个用户同时与多个目标库用户冲突，请确认归属是否正确\n", multi)
+	}
+}
+
+// transformUserUnique 按用户冲突的处理方式转换唯一列：skip/merge 的用户整行跳过，
+// rename 时冲突的用户名改为加后缀的新名字，其余冲突的列清空（access_token 置为 NULL 以免违反唯一约束）
+func transformUserUnique(ctx *transformContext, value any) (any, error) {
+	raw, _ := ctx.Source("id")
+	id, err := toInt64(raw)
+	if err != nil {
+		return value, nil
+	}
+	c, ok := userCollisions[id]
+	if !ok {
+		return value, nil
+	}
+	item := fmt.Sprintf("id=%d -> %d", c.SourceID, c.TargetID)
+	if c.Policy != collisionRename {
+		ctx.Group(fmt.Sprintf("与目标库用户冲突，%s", c.Policy), item)
+		return nil, errSkipRow
+	}
+	if indexOf(c.Columns, ctx.Column) == -1 {
+		return value, nil
+	}
+	if ctx.Column == "username" {
+		ctx.Group("与目标库用户冲突，rename", fmt.Sprintf("id=%d(%s)", c.SourceID, c.Username))
+		return c.Username, nil
+	}
+	if ctx.Column == "access_token" {
+		return nil, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// collisionTargetUsers 是与测试源库用户冲突的目标库用户：
+// root 只有用户名冲突；alice 的 email 与 11、github_id 与 access_token 与 12 冲突；
+// root_onehub 占用了 rename 的默认用户名
+const collisionTargetUsers = `
+INSERT INTO users (id, username, password, email, github_id, access_token, quota, used_quota, request_count, aff_code) VALUES (10, 'root', 'pw', 'r@y.com', '', 't10', 1, 2, 3, 'c10');
+INSERT INTO users (id, username, password, email, github_id, access_token, quota, used_quota, request_count, aff_code) VALUES (11, 'al', 'pw', 'alice@x.com', '', NULL, 0, 0, 0, 'c11');
+INSERT INTO users (id, username, password, email, github_id, access_token, quota, used_quota, request_count, aff_code) VALUES (12, 'bo', 'pw', '', 'gh2', 'tok2', 0, 0, 0, 'c12');
+INSERT INTO users (id, username, password, email, github_id, access_token, quota, used_quota, request_count, aff_code) VALUES (13, 'root_onehub', 'pw', '', '', NULL, 0, 0, 0, 'c13');
+`
+
+// setupCollisionTest 准备带冲突用户的源库与目标库，并按 policy 设置用户冲突的全局配置
+func setupCollisionTest(t *testing.T, policy string) (oldDB, newDB *sql.DB, tm TableMapping) {
+	t.Helper()
+	src, dst := newFixture(t)
+	execSQL(t, dst, collisionTargetUsers)
+	config = Config{OldDSN: src, NewDSN: dst, UserCollision: policy, UserRenameSuffix: defaultRenameSuffix}
+	mapping = defaultMapping()
+	ids = nil
+	console = io.Discard
+	t.Cleanup(func() { config = Config{} })
+	tm, _ = mapping.tableFor("users")
+	return openTestDB(t, src), openTestDB(t, dst), tm
+}
+
+func TestDetectUserCollisions(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   []userCollision
+	}{
+		{
+			policy: collisionRename,
+			want: []userCollision{
+				{SourceID: 1, TargetID: 10, Policy: collisionRename, Columns: []string{"username"}, Username: "root_onehub2", quota: []int64{}},
+				{SourceID: 2, TargetID: 11, Policy: collisionRename, Columns: []string{"email", "github_id", "access_token"}, OtherTargets: []int64{12}, quota: []int64{}},
+			},
+		},
+		{
+			policy: collisionSkip,
+			want: []userCollision{
+				{SourceID: 1, TargetID: 10, Policy: collisionSkip, Columns: []string{"username"}, quota: []int64{}},
+				{SourceID: 2, TargetID: 11, Policy: collisionSkip, Columns: []string{"email", "github_id", "access_token"}, OtherTargets: []int64{12}, quota: []int64{}},
+			},
+		},
+		{
+			policy: collisionMerge,
+			want: []userCollision{
+				{SourceID: 1, TargetID: 10, Policy: collisionMerge, Columns: []string{"username"}, quota: []int64{1000, 10, 1}},
+				{SourceID: 2, TargetID: 11, Policy: collisionMerge, Columns: []string{"email", "github_id", "access_token"}, OtherTargets: []int64{12}, quota: []int64{500, 5, 1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			oldDB, newDB, tm := setupCollisionTest(t, tt.policy)
+			got, err := detectUserCollisions(oldDB, newDB, tm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectUserCollisions =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 与迁移后 id 相同的目标库用户视为同一行，不算冲突
+func TestDetectUserCollisionsSameRow(t *testing.T) {
+	oldDB, newDB, tm := setupCollisionTest(t, collisionSkip)
+	if _, err := newDB.Exec("DELETE FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newDB.Exec("INSERT INTO users (id, username, password, email, aff_code) VALUES (1, 'root', 'pw', 'root@x.com', 'a1')"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := detectUserCollisions(oldDB, newDB, tm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("id 相同的用户不应视为冲突: %+v", got)
+	}
+}
+
+func TestMergeUserQuotasOnce(t *testing.T) {
+	oldDB, newDB, tm := setupCollisionTest(t, collisionMerge)
+	collisions, err := detectUserCollisions(oldDB, newDB, tm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota := func(id int64) (q, used, count int64) {
+		t.Helper()
+		if err := newDB.QueryRow("SELECT quota, used_quota, request_count FROM users WHERE id = ?", id).Scan(&q, &used, &count); err != nil {
+			t.Fatal(err)
+		}
+		return q, used, count
+	}
+	check := func(step string, want10, want11 [3]int64) {
+		t.Helper()
+		if q, u, c := quota(10); [3]int64{q, u, c} != want10 {
+			t.Errorf("%s: 用户 10 的额度 = %v, want %v", step, [3]int64{q, u, c}, want10)
+		}
+		if q, u, c := quota(11); [3]int64{q, u, c} != want11 {
+			t.Errorf("%s: 用户 11 的额度 = %v, want %v", step, [3]int64{q, u, c}, want11)
+		}
+	}
+
+	if err := mergeUserQuotas(newDB, collisions); err != nil {
+		t.Fatal(err)
+	}
+	check("第一次合并", [3]int64{1001, 12, 4}, [3]int64{500, 5, 1})
+
+	var raw string
+	if err := newDB.QueryRow("SELECT value FROM options WHERE key = ?", quotaMergeOption).Scan(&raw); err != nil {
+		t.Fatalf("应在目标库记录 %s: %v", quotaMergeOption, err)
+	}
+	var recorded map[string]int64
+	if err := json.Unmarshal([]byte(raw), &recorded); err != nil {
+		t.Fatal(err)
+	}
+	source := dsnFingerprint(config.OldDSN)
+	if want := map[string]int64{source + ":1": 10, source + ":2": 11}; !reflect.DeepEqual(recorded, want) {
+		t.Errorf("%s = %v, want %v", quotaMergeOption, recorded, want)
+	}
+
+	if err := mergeUserQuotas(newDB, collisions); err != nil {
+		t.Fatal(err)
+	}
+	check("重复合并", [3]int64{1001, 12, 4}, [3]int64{500, 5, 1})
+
+	config.RemergeQuotas = true
+	if err := mergeUserQuotas(newDB, collisions[:1]); err != nil {
+		t.Fatal(err)
+	}
+	check("--remerge-quotas", [3]int64{2001, 22, 5}, [3]int64{500, 5, 1})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// conflictPolicy 决定写入目标库时遇到主键/唯一键冲突的处理方式
+type conflictPolicy string
+
+const (
+	// conflictIgnore 保留目标库已有的行（INSERT IGNORE / ON CONFLICT DO NOTHING）
+	conflictIgnore conflictPolicy = "ignore"
+	// conflictUpsert 用源库的值覆盖目标库已有的行
+	conflictUpsert conflictPolicy = "upsert"
+	// conflictError 遇到冲突即报错，当前事务回滚
+	conflictError conflictPolicy = "error"
+)
+
+func parseConflictPolicy(s string) (conflictPolicy, error) {
+	switch p := conflictPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case conflictIgnore, conflictUpsert, conflictError:
+		return p, nil
+	default:
+		return "", fmt.Errorf("未知的冲突策略 %q（可选 ignore/upsert/error）", s)
+	}
+}
+
+// conflictPolicies 是默认策略加上按表覆盖的策略
+type conflictPolicies struct {
+	Default  conflictPolicy
+	PerTable map[string]conflictPolicy
+}
+
+// parseConflictPolicies 解析形如 "upsert" 或 "ignore,users=upsert,logs=error" 的配置：
+// 不带表名的项设置默认策略，table=policy 设置单张表的策略
+func parseConflictPolicies(s string) (conflictPolicies, error) {
+	policies := conflictPolicies{Default: conflictIgnore, PerTable: make(map[string]conflictPolicy)}
+	for _, item := range splitCSVTrim(s) {
+		table, value, perTable := strings.Cut(item, "=")
+		if !perTable {
+			p, err := parseConflictPolicy(item)
+			if err != nil {
+				return policies, err
+			}
+			policies.Default = p
+			continue
+		}
+		p, err := parseConflictPolicy(value)
+		if err != nil {
+			return policies, err
+		}
+		policies.PerTable[strings.TrimSpace(table)] = p
+	}
+	return policies, nil
+}
+
+func (c conflictPolicies) forTable(table string) conflictPolicy {
+	if p, ok := c.PerTable[table]; ok {
+		return p
+	}
+	if c.Default == "" {
+		return conflictIgnore
+	}
+	return c.Default
+}
+
+// checkConflictKeys 确认 upsert 所需的主键列都在写入的列中
+func checkConflictKeys(table string, policy conflictPolicy, columns []string) error {
+	if policy != conflictUpsert {
+		return nil
+	}
+	keys := mapping.targetKeys(table)
+	if len(keys) == 0 {
+		return fmt.Errorf("表 %s 没有已知的主键，无法使用 upsert 策略", table)
+	}
+	for _, k := range keys {
+		if !contains(columns, k) {
+			return fmt.Errorf("表 %s 的主键列 %s 不在迁移字段中，无法使用 upsert 策略", table, k)
+		}
+	}
+	return nil
+}
+
+// mysqlRowAlias 为 true 时 MySQL 的 upsert 使用 8.0.19 起支持的行别名（VALUES (...) AS new），
+// 代替 8.0.20 起弃用的 VALUES(col)；由 detectUpsertSyntax 按目标库版本设置
+var mysqlRowAlias bool
+
+// mysqlRowAliasName 是 upsert 语句中新行的别名
+const mysqlRowAliasName = "new"
+
+// detectUpsertSyntax 读取目标库版本，决定 MySQL upsert 的写法；MariaDB 不支持行别名
+func detectUpsertSyntax(db *sql.DB, driver string) {
+	mysqlRowAlias = driver == "mysql" && mysqlVersionAtLeast(serverVersion(db, driver), 8, 0, 19)
+}
+
+// mysqlVersionAtLeast 比较形如 8.0.36 或 8.0.19-log 的 MySQL 版本号，MariaDB 与无法解析的版本返回 false
+func mysqlVersionAtLeast(version string, major, minor, patch int) bool {
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return false
+	}
+	core, _, _ := strings.Cut(version, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) < 3 {
+		return false
+	}
+	want := []int{major, minor, patch}
+	for i, w := range want {
+		got, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return false
+		}
+		if got != w {
+			return got > w
+		}
+	}
+	return true
+}
+
+// buildInsertStatement 按驱动和冲突策略拼接 INSERT 语句，values 为 VALUES 之后的占位符部分。
+// Postgres/SQLite 的 upsert 只按主键（mapping.targetKeys）判断冲突，与其他唯一索引冲突时仍会报错；
+// MySQL 的 ON DUPLICATE KEY UPDATE 对所有唯一索引生效
+func buildInsertStatement(table string, columns []string, driver string, values string, policy conflictPolicy) string {
+	quotedCols := make([]string, 0, len(columns))
+	for _, col := range columns {
+		quotedCols = append(quotedCols, quoteIdent(driver, col))
+	}
+	tableIdent := quoteIdent(driver, table)
+	colList := strings.Join(quotedCols, ",")
+
+	keys := mapping.targetKeys(table)
+	var updates []string
+	for _, col := range columns {
+		if contains(keys, col) {
+			continue
+		}
+		switch {
+		case driver == "mysql" && mysqlRowAlias:
+			updates = append(updates, fmt.Sprintf("%s=%s.%s", quoteIdent(driver, col), quoteIdent(driver, mysqlRowAliasName), quoteIdent(driver, col)))
+		case driver == "mysql":
+			updates = append(updates, fmt.Sprintf("%s=VALUES(%s)", quoteIdent(driver, col), quoteIdent(driver, col)))
+		default:
+			updates = append(updates, fmt.Sprintf("%s=excluded.%s", quoteIdent(driver, col), quoteIdent(driver, col)))
+		}
+	}
+	// 只有主键列可写时 upsert 退化为忽略
+	if policy == conflictUpsert && len(updates) == 0 {
+		policy = conflictIgnore
+	}
+
+	switch policy {
+	case conflictError:
+		return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", tableIdent, colList, values)
+	case conflictUpsert:
+		switch {
+		case driver == "mysql" && mysqlRowAlias:
+			return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s AS %s ON DUPLICATE KEY UPDATE %s", tableIdent, colList, values, quoteIdent(driver, mysqlRowAliasName), strings.Join(updates, ","))
+		case driver == "mysql":
+			return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON DUPLICATE KEY UPDATE %s", tableIdent, colList, values, strings.Join(updates, ","))
+		default:
+			quotedKeys := make([]string, 0, len(keys))
+			for _, k := range keys {
+				quotedKeys = append(quotedKeys, quoteIdent(driver, k))
+			}
+			return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) DO UPDATE SET %s", tableIdent, colList, values, strings.Join(quotedKeys, ","), strings.Join(updates, ","))
+		}
+	default:
+		switch driver {
+		case "mysql":
+			return fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES %s", tableIdent, colList, values)
+		case "sqlite":
+			return fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES %s", tableIdent, colList, values)
+		default:
+			return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON CONFLICT DO NOTHING", tableIdent, colList, values)
+		}
+	}
+}
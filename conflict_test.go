@@ -0,0 +1,149 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildInsertStatement(t *testing.T) {
+	mapping = defaultMapping()
+	cols := []string{"id", "name", "quota"}
+	tests := []struct {
+		name     string
+		table    string
+		columns  []string
+		driver   string
+		policy   conflictPolicy
+		rowAlias bool
+		want     string
+	}{
+		{
+			name: "mysql ignore", table: "users", columns: cols, driver: "mysql", policy: conflictIgnore,
+			want: "INSERT IGNORE INTO `users` (`id`,`name`,`quota`) VALUES (?,?,?)",
+		},
+		{
+			name: "sqlite ignore", table: "users", columns: cols, driver: "sqlite", policy: conflictIgnore,
+			want: "INSERT OR IGNORE INTO `users` (`id`,`name`,`quota`) VALUES (?,?,?)",
+		},
+		{
+			name: "postgres ignore", table: "users", columns: cols, driver: "postgres", policy: conflictIgnore,
+			want: `INSERT INTO "users" ("id","name","quota") VALUES (?,?,?) ON CONFLICT DO NOTHING`,
+		},
+		{
+			name: "error", table: "users", columns: cols, driver: "postgres", policy: conflictError,
+			want: `INSERT INTO "users" ("id","name","quota") VALUES (?,?,?)`,
+		},
+		{
+			name: "mysql upsert VALUES()", table: "users", columns: cols, driver: "mysql", policy: conflictUpsert,
+			want: "INSERT INTO `users` (`id`,`name`,`quota`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`quota`=VALUES(`quota`)",
+		},
+		{
+			name: "mysql upsert 行别名", table: "users", columns: cols, driver: "mysql", policy: conflictUpsert, rowAlias: true,
+			want: "INSERT INTO `users` (`id`,`name`,`quota`) VALUES (?,?,?) AS `new` ON DUPLICATE KEY UPDATE `name`=`new`.`name`,`quota`=`new`.`quota`",
+		},
+		{
+			name: "postgres upsert 按主键", table: "users", columns: cols, driver: "postgres", policy: conflictUpsert,
+			want: `INSERT INTO "users" ("id","name","quota") VALUES (?,?,?) ON CONFLICT ("id") DO UPDATE SET "name"=excluded."name","quota"=excluded."quota"`,
+		},
+		{
+			name: "sqlite upsert 复合主键", table: "abilities", columns: []string{"group", "model", "channel_id", "enabled"}, driver: "sqlite", policy: conflictUpsert,
+			want: "INSERT INTO `abilities` (`group`,`model`,`channel_id`,`enabled`) VALUES (?,?,?,?) ON CONFLICT (`group`,`model`,`channel_id`) DO UPDATE SET `enabled`=excluded.`enabled`",
+		},
+		{
+			name: "只有主键列时 upsert 退化为忽略", table: "users", columns: []string{"id"}, driver: "sqlite", policy: conflictUpsert,
+			want: "INSERT OR IGNORE INTO `users` (`id`) VALUES (?)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mysqlRowAlias = tt.rowAlias
+			defer func() { mysqlRowAlias = false }()
+			got := buildInsertStatement(tt.table, tt.columns, tt.driver, "("+placeholders(len(tt.columns))+")", tt.policy)
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func placeholders(n int) string {
+	s := "?"
+	for i := 1; i < n; i++ {
+		s += ",?"
+	}
+	return s
+}
+
+func TestParseConflictPolicies(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    conflictPolicies
+		wantErr bool
+	}{
+		{in: "", want: conflictPolicies{Default: conflictIgnore, PerTable: map[string]conflictPolicy{}}},
+		{in: "upsert", want: conflictPolicies{Default: conflictUpsert, PerTable: map[string]conflictPolicy{}}},
+		{in: " ERROR ", want: conflictPolicies{Default: conflictError, PerTable: map[string]conflictPolicy{}}},
+		{
+			in: "ignore,users=upsert, logs = error",
+			want: conflictPolicies{Default: conflictIgnore, PerTable: map[string]conflictPolicy{
+				"users": conflictUpsert, "logs": conflictError,
+			}},
+		},
+		{in: "users=upsert", want: conflictPolicies{Default: conflictIgnore, PerTable: map[string]conflictPolicy{"users": conflictUpsert}}},
+		{in: "replace", wantErr: true},
+		{in: "users=replace", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseConflictPolicies(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseConflictPolicies(%q) 应返回错误", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConflictPolicies(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConflictPoliciesForTable(t *testing.T) {
+	p := conflictPolicies{Default: conflictError, PerTable: map[string]conflictPolicy{"users": conflictUpsert}}
+	if got := p.forTable("users"); got != conflictUpsert {
+		t.Errorf("forTable(users) = %s", got)
+	}
+	if got := p.forTable("logs"); got != conflictError {
+		t.Errorf("forTable(logs) = %s", got)
+	}
+	if got := (conflictPolicies{}).forTable("logs"); got != conflictIgnore {
+		t.Errorf("零值的 forTable(logs) = %s，应为 ignore", got)
+	}
+}
+
+func TestMySQLVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"8.0.19", true},
+		{"8.0.36-log", true},
+		{"8.4.0", true},
+		{"9.0.1", true},
+		{"8.0.18", false},
+		{"5.7.44", false},
+		{"10.11.6-MariaDB", false},
+		{"5.5.5-10.6.12-MariaDB-log", false},
+		{"8.0", false},
+		{"未知", false},
+	}
+	for _, tt := range tests {
+		if got := mysqlVersionAtLeast(tt.version, 8, 0, 19); got != tt.want {
+			t.Errorf("mysqlVersionAtLeast(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
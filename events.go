@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// eventFields 是结构化事件的附加字段
+type eventFields map[string]any
+
+// eventLog 输出迁移过程中的关键步骤：text 格式输出原有的中文提示，
+// json 格式每个事件输出一行 JSON（其余提示改写到 stderr，保证 stdout 可被直接解析）
+type eventLog struct {
+	mu     sync.Mutex
+	format string
+	out    io.Writer
+}
+
+var events = &eventLog{format: logFormatText, out: os.Stdout}
+
+// console 是面向人的提示的输出位置。json 格式下改为 stderr，stdout 只有事件
+var console io.Writer = os.Stdout
+
+// setupEvents 切换日志格式；json 格式下提示改写到 stderr，只有事件写入 stdout
+func setupEvents(format string) error {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", logFormatText:
+		events.format = logFormatText
+	case logFormatJSON:
+		events.format = logFormatJSON
+		console = os.Stderr
+	default:
+		return fmt.Errorf("未知的日志格式 %q（可选 text/json）", format)
+	}
+	return nil
+}
+
+func (l *eventLog) json() bool {
+	return l.format == logFormatJSON
+}
+
+// logEvent 记录一个事件：text 格式按 format 输出提示，json 格式输出 {"time","event","msg",...fields}
+func logEvent(name string, fields eventFields, format string, args ...any) {
+	if !events.json() {
+		fmt.Fprintf(console, format, args...)
+		return
+	}
+	record := make(map[string]any, len(fields)+3)
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		record[k] = v
+	}
+	record["time"] = time.Now().Format(time.RFC3339Nano)
+	record["event"] = name
+	record["msg"] = strings.TrimSpace(fmt.Sprintf(format, args...))
+	events.write(record)
+}
+
+func (l *eventLog) write(record any) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.out.Write(append(data, '\n'))
+}
+
+// tableStats 是一张表本次运行的行数统计
+type tableStats struct {
+	// Read 是从源库读取的行数，Written 是已提交到目标库的行数，Skipped 是按规则跳过的行数
+	Read    int64 `json:"read"`
+	Written int64 `json:"written"`
+	Skipped int64 `json:"skipped"`
+}
+
+// tableSummary 是运行汇总中单张表的结果
+type tableSummary struct {
+	Table string `json:"table"`
+	// Status 为 ok、failed、skipped（表不存在等原因跳过）、done（断点显示之前已完成）
+	// 或 cancelled（--fail-fast 下因其他表失败而未迁移完）
+	Status string `json:"status"`
+	tableStats
+	// Failed 是已读取但未能提交的行数
+	Failed     int64  `json:"failed"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// runSummary 是一次迁移的机器可读汇总
+type runSummary struct {
+	StartedAt    time.Time      `json:"started_at"`
+	FinishedAt   time.Time      `json:"finished_at"`
+	DurationMS   int64          `json:"duration_ms"`
+	Workers      int            `json:"workers"`
+	Tables       []tableSummary `json:"tables"`
+	FailedTables int            `json:"failed_tables"`
+	// CancelledTables 是 --fail-fast 下未迁移完的表数
+	CancelledTables int `json:"cancelled_tables,omitempty"`
+	// Backup 是本次运行写入前的目标库备份目录
+	Backup string `json:"backup,omitempty"`
+	// Prices 为 migrated/failed，未迁移价格时为空
+	Prices string `json:"prices,omitempty"`
+	// Groups 为 migrated/failed，未迁移分组时为空；MissingGroups 是目标库引用了但不在 GroupRatio 中的分组
+	Groups        string   `json:"groups,omitempty"`
+	MissingGroups []string `json:"missing_groups,omitempty"`
+	// Verify 为 passed/failed，未执行校验时为空
+	Verify string `json:"verify,omitempty"`
+	// ExitCode 是进程的退出码
+	ExitCode int `json:"exit_code"`
+}
+
+func (s *runSummary) finish() {
+	s.FinishedAt = time.Now()
+	s.DurationMS = s.FinishedAt.Sub(s.StartedAt).Milliseconds()
+}
+
+// writeRunSummary 在 json 格式下把汇总作为最后一个事件输出，并在 path 非空时写入文件
+func writeRunSummary(s *runSummary, path string) {
+	if events.json() {
+		events.write(map[string]any{"time": s.FinishedAt.Format(time.RFC3339Nano), "event": "summary", "summary": s})
+	}
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		fmt.Fprintf(console, "⚠️ 生成运行汇总失败: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		fmt.Fprintf(console, "⚠️ 写入运行汇总 %s 失败: %v\n", path, err)
+		return
+	}
+	fmt.Fprintf(console, "📝 运行汇总已写入 %s\n", path)
+}
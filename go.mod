@@ -5,6 +5,7 @@ go 1.21
 require (
 	github.com/go-sql-driver/mysql v1.7.0
 	github.com/lib/pq v1.10.9
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.30.1
 )
 
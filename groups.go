@@ -0,0 +1,232 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultGroupRatio 是 one-api 内置的分组倍率，目标库没有 GroupRatio 配置时在此基础上合并
+var defaultGroupRatio = map[string]float64{"default": 1, "vip": 1, "svip": 1}
+
+// groupRefTables 是引用分组的目标表：表 -> 是否为逗号分隔的多个分组
+var groupRefTables = []struct {
+	Table string
+	Multi bool
+}{
+	{"users", false},
+	{"channels", true},
+	{"abilities", false},
+}
+
+// readOneHubGroups 读取源库 user_groups 表，返回 symbol -> ratio；表不存在时 ok 为 false
+func readOneHubGroups(oldDB *sql.DB) (groups map[string]float64, ok bool, err error) {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	columns := getColumns(oldDB, "user_groups", oldDriver)
+	if len(columns) == 0 {
+		return nil, false, nil
+	}
+	for _, col := range []string{"symbol", "ratio"} {
+		if indexOf(columns, col) == -1 {
+			return nil, true, fmt.Errorf("源库 user_groups 表缺少列 %s", col)
+		}
+	}
+	rows, err := oldDB.Query(fmt.Sprintf("SELECT %s, %s FROM %s", quoteIdent(oldDriver, "symbol"),
+		quoteIdent(oldDriver, "ratio"), quoteIdent(oldDriver, "user_groups")))
+	if err != nil {
+		return nil, true, err
+	}
+	defer rows.Close()
+
+	groups = make(map[string]float64)
+	for rows.Next() {
+		var symbol, ratio any
+		if err := rows.Scan(&symbol, &ratio); err != nil {
+			return nil, true, err
+		}
+		name := strings.TrimSpace(valueString(symbol))
+		if name == "" {
+			continue
+		}
+		r, err := parsePrice(ratio)
+		if err != nil {
+			return nil, true, fmt.Errorf("分组 %s 的 ratio 无效: %w", name, err)
+		}
+		groups[name] = roundRatio(r)
+	}
+	return groups, true, rows.Err()
+}
+
+// groupRefs 统计 db 中各表引用的分组：分组 -> 表 -> 行数，tables 为要检查的表
+func groupRefs(db *sql.DB, driver string, tables []string) (map[string]map[string]int, error) {
+	refs := make(map[string]map[string]int)
+	for _, ref := range groupRefTables {
+		if indexOf(tables, ref.Table) == -1 || indexOf(getColumns(db, ref.Table, driver), "group") == -1 {
+			continue
+		}
+		rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s", quoteIdent(driver, "group"), quoteIdent(driver, ref.Table)))
+		if err != nil {
+			return nil, fmt.Errorf("读取表 %s 的分组失败: %w", ref.Table, err)
+		}
+		for rows.Next() {
+			var raw any
+			if err := rows.Scan(&raw); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			names := []string{valueString(raw)}
+			if ref.Multi {
+				names = strings.Split(names[0], ",")
+			}
+			for _, name := range names {
+				if name = strings.TrimSpace(name); name == "" {
+					continue
+				}
+				if refs[name] == nil {
+					refs[name] = make(map[string]int)
+				}
+				refs[name][ref.Table]++
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// missingGroups 返回 refs 中不在 ratios 里的分组（排序），并逐个输出引用它的表与行数
+func missingGroups(refs map[string]map[string]int, ratios map[string]float64) []string {
+	var missing []string
+	for name := range refs {
+		if _, ok := ratios[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) == 0 {
+		return nil
+	}
+	logEvent("groups_missing", eventFields{"groups": missing},
+		"   ⚠️ %d 个分组不在 GroupRatio 中，one-api 会按倍率 1 计费并记录错误:\n", len(missing))
+	for _, name := range missing {
+		var parts []string
+		for _, ref := range groupRefTables {
+			if n := refs[name][ref.Table]; n > 0 {
+				parts = append(parts, fmt.Sprintf("%s %d 行", ref.Table, n))
+			}
+		}
+		fmt.Fprintf(console, "      - %s（%s）\n", name, strings.Join(parts, "、"))
+	}
+	return missing
+}
+
+// targetGroupRatio 读取目标库当前的 GroupRatio，没有配置时返回 one-api 的内置值
+func targetGroupRatio(newDB *sql.DB) (map[string]float64, error) {
+	newDriver, _ := detectDriver(config.NewDSN)
+	tx, err := newDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	raw, ok, err := readOption(tx, newDriver, "GroupRatio")
+	if err != nil || !ok || raw == "" {
+		return defaultGroupRatio, err
+	}
+	ratios := make(map[string]float64)
+	if err := json.Unmarshal([]byte(raw), &ratios); err != nil {
+		return nil, fmt.Errorf("目标库配置项 GroupRatio 不是合法的 JSON: %w", err)
+	}
+	return ratios, nil
+}
+
+// migrateGroups 把 one-hub user_groups 表合并进目标库的 GroupRatio（同名分组以 one-hub 为准），
+// 然后检查目标库 users/channels/abilities 引用的分组都在 GroupRatio 中，返回缺少的分组
+func migrateGroups(oldDB, newDB *sql.DB) ([]string, error) {
+	groups, ok, err := readOneHubGroups(oldDB)
+	if err != nil {
+		return nil, fmt.Errorf("读取源库 user_groups 表失败: %w", err)
+	}
+	if !ok {
+		fmt.Fprintln(console, "⚠️ 源库中没有找到表: user_groups，只检查分组引用")
+	} else {
+		newDriver, _ := detectDriver(config.NewDSN)
+		tx, err := newDB.Begin()
+		if err != nil {
+			return nil, err
+		}
+		merged, err := mergeRatioOption(tx, newDriver, "GroupRatio", groups, defaultGroupRatio)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		logEvent("groups_migrated", eventFields{"groups": len(groups), "added": merged.Added, "changed": merged.Changed, "kept": merged.Kept, "seeded": merged.Seeded},
+			"👪 已把 %d 个 one-hub 分组写入 GroupRatio（新增 %d、修改 %d、保留目标库原值 %d）\n", len(groups), merged.Added, merged.Changed, merged.Kept)
+		if merged.Seeded > 0 {
+			fmt.Fprintf(console, "   目标库原本没有配置 GroupRatio，已在 one-api 内置的 %d 个默认分组基础上合并\n", merged.Seeded)
+		}
+	}
+
+	ratios, err := targetGroupRatio(newDB)
+	if err != nil {
+		return nil, err
+	}
+	newDriver, _ := detectDriver(config.NewDSN)
+	refs, err := groupRefs(newDB, newDriver, []string{"users", "channels", "abilities"})
+	if err != nil {
+		return nil, err
+	}
+	return missingGroups(refs, ratios), nil
+}
+
+// planGroups 输出分组迁移的预览：源库 users/channels 引用的分组是否都会出现在迁移后的 GroupRatio 中
+func planGroups(oldDB, newDB *sql.DB) {
+	groups, ok, err := readOneHubGroups(oldDB)
+	if err != nil {
+		fmt.Fprintf(console, "⚠️ 无法读取源库 user_groups 表: %v\n", err)
+		return
+	}
+	ratios, err := targetGroupRatio(newDB)
+	if err != nil {
+		fmt.Fprintf(console, "⚠️ %v\n", err)
+		return
+	}
+	merged := make(map[string]float64, len(ratios)+len(groups))
+	for name, r := range ratios {
+		merged[name] = r
+	}
+	for name, r := range groups {
+		merged[name] = r
+	}
+	if ok {
+		fmt.Fprintf(console, "👪 分组迁移：%d 个 one-hub 分组将写入 GroupRatio\n", len(groups))
+	} else {
+		fmt.Fprintln(console, "👪 分组迁移：源库中没有 user_groups 表，只检查分组引用")
+	}
+	oldDriver, _ := detectDriver(config.OldDSN)
+	var tables []string
+	for _, name := range []string{"users", "channels"} {
+		if _, ok := mapping.tableFor(name); ok {
+			tables = append(tables, name)
+		}
+	}
+	refs, err := groupRefs(oldDB, oldDriver, tables)
+	if err != nil {
+		fmt.Fprintf(console, "⚠️ %v\n", err)
+		return
+	}
+	missingGroups(refs, merged)
+}
+
+// groupsEnabled 表示本次运行是否迁移分组：分组写入 options 表，只在迁移 options 时进行
+func groupsEnabled() bool {
+	_, ok := mapping.tableFor("options")
+	return config.MigrateGroups && ok
+}
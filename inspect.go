@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// runInspect 是 inspect 子命令：只读地输出两端数据库版本、各表行数与列差异，以及源库渠道类型分布
+func runInspect() int {
+	oldDB := openDatabase(config.OldDSN)
+	newDB := openDatabase(config.NewDSN)
+	oldDriver, _ := detectDriver(config.OldDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+
+	fmt.Fprintf(console, "🔎 源库: %s %s\n", oldDriver, serverVersion(oldDB, oldDriver))
+	fmt.Fprintf(console, "🔎 目标库: %s %s\n", newDriver, serverVersion(newDB, newDriver))
+	fmt.Fprintln(console, "======================")
+
+	for _, tm := range mapping.Tables {
+		fmt.Fprintf(console, "📋 表 %s\n", tm.name())
+		oldColumns := getColumns(oldDB, tm.Source, oldDriver)
+		newColumns := getColumns(newDB, tm.Target, newDriver)
+		fmt.Fprintf(console, "   源表 %s: %s\n", tm.Source, describeTable(oldDB, oldDriver, tm.Source, oldColumns))
+		fmt.Fprintf(console, "   目标表 %s: %s\n", tm.Target, describeTable(newDB, newDriver, tm.Target, newColumns))
+		if len(oldColumns) == 0 || len(newColumns) == 0 {
+			continue
+		}
+		cols := tm.resolveColumns(oldColumns, newColumns)
+		if len(cols.Dropped) > 0 {
+			fmt.Fprintf(console, "   源表独有的列（不迁移）: %v\n", cols.Dropped)
+		}
+		if len(cols.TargetOnly) > 0 {
+			fmt.Fprintf(console, "   目标表独有的列（使用默认值）: %v\n", cols.TargetOnly)
+		}
+	}
+
+	for _, tm := range mapping.Tables {
+		if tm.Target != "channels" || len(getColumns(oldDB, tm.Source, oldDriver)) == 0 {
+			continue
+		}
+		fmt.Fprintln(console, "======================")
+		if err := inspectChannelTypes(oldDB, oldDriver, tm.Source); err != nil {
+			fmt.Fprintf(console, "⚠️ 统计渠道类型失败: %v\n", err)
+		}
+	}
+	return 0
+}
+
+func describeTable(db *sql.DB, driver, table string, columns []string) string {
+	if len(columns) == 0 {
+		return "不存在"
+	}
+	var rows int64
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdent(driver, table))).Scan(&rows); err != nil {
+		return fmt.Sprintf("%d 列，统计行数失败: %v", len(columns), err)
+	}
+	return fmt.Sprintf("%d 列，%d 行", len(columns), rows)
+}
+
+// inspectChannelTypes 按 one-hub 渠道类型分组统计源库渠道，并给出迁移时的处理方式
+func inspectChannelTypes(db *sql.DB, driver, table string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, COUNT(*) FROM %s GROUP BY %s",
+		quoteIdent(driver, "type"), quoteIdent(driver, table), quoteIdent(driver, "type")))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int64)
+	for rows.Next() {
+		var typ, n int64
+		if err := rows.Scan(&typ, &n); err != nil {
+			return err
+		}
+		counts[int(typ)] += n
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	types := make([]int, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Ints(types)
+	fmt.Fprintln(console, "📊 源库渠道类型分布:")
+	for _, t := range types {
+		// base_url 因渠道而异，这里按非空处理，为空的渠道迁移时会被禁用
+		d := decideChannel(t, "-")
+		result := fmt.Sprintf("one-api 类型 %d", d.Type)
+		if d.Fallback != "" {
+			result = d.label()
+		}
+		fmt.Fprintf(console, "   one-hub 类型 %d: %d 个 → %s\n", t, counts[t], result)
+	}
+	return nil
+}
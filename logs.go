@@ -0,0 +1,459 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logsLocation 是解析 --logs-* 时间与按自然日汇总日志所用的时区，即本地时区（可用 TZ 环境变量指定）
+var logsLocation = time.Local
+
+// logsTimeLayouts 是 --logs-since/--logs-until 接受的时间格式（本地时区），只有日期时 until 包含当天
+var logsTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseLogsTime 把 --logs-since/--logs-until 的值解析为 Unix 秒，为空时返回 0。
+// 支持 90d 这样的相对天数（从当前时间往前推）；end 为 true 且只给出日期时返回次日零点，使 until 包含当天
+func parseLogsTime(s string, end bool) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("无效的相对天数 %q（如 90d）", s)
+		}
+		return time.Now().AddDate(0, 0, -n).Unix(), nil
+	}
+	for _, layout := range logsTimeLayouts {
+		t, err := time.ParseInLocation(layout, s, logsLocation)
+		if err != nil {
+			continue
+		}
+		if end && layout == "2006-01-02" {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t.Unix(), nil
+	}
+	return 0, fmt.Errorf("无效的时间 %q（可选 2006-01-02、2006-01-02 15:04:05、RFC3339 或 90d）", s)
+}
+
+// parseLogsWindow 解析 --logs-since/--logs-until，返回 created_at 的范围 [since, until)
+func parseLogsWindow(since, until string) (int64, int64, error) {
+	from, err := parseLogsTime(since, false)
+	if err != nil {
+		return 0, 0, fmt.Errorf("--logs-since: %w", err)
+	}
+	to, err := parseLogsTime(until, true)
+	if err != nil {
+		return 0, 0, fmt.Errorf("--logs-until: %w", err)
+	}
+	if from > 0 && to > 0 && from >= to {
+		return 0, 0, fmt.Errorf("--logs-since 应早于 --logs-until")
+	}
+	return from, to, nil
+}
+
+// logsWindow 描述 --logs-since/--logs-until 对表 tm 限定的时间范围，不是 logs 或没有设置时返回空字符串
+func logsWindow(tm TableMapping) string {
+	if tm.Target != "logs" {
+		return ""
+	}
+	format := func(ts int64) string { return time.Unix(ts, 0).Format("2006-01-02 15:04:05") }
+	switch {
+	case config.LogsSince > 0 && config.LogsUntil > 0:
+		return fmt.Sprintf("created_at 不早于 %s 且早于 %s", format(config.LogsSince), format(config.LogsUntil))
+	case config.LogsSince > 0:
+		return fmt.Sprintf("created_at 不早于 %s", format(config.LogsSince))
+	case config.LogsUntil > 0:
+		return fmt.Sprintf("created_at 早于 %s", format(config.LogsUntil))
+	}
+	return ""
+}
+
+// logsFilter 返回对源表逐行复制的过滤条件（不含 WHERE）及参数，first 是第一个占位符的序号：
+// --logs-since/--logs-until 之外的日志不迁移，--logs-rollup-before 之前的消费日志由汇总写入。
+// 只作用于写入 logs 的表，没有设置时返回空字符串
+func logsFilter(tm TableMapping, driver string, first int) (string, []any) {
+	conds, args := logsWindowConds(tm, driver, first)
+	if logsRollupEnabled(tm) {
+		typeCol := quoteIdent(driver, tm.sourceColumnFor("type"))
+		conds = append(conds, fmt.Sprintf("(%s >= %s OR %s IS NULL OR %s <> %d)", quoteIdent(driver, tm.sourceColumnFor("created_at")),
+			placeholderAt(driver, first+len(args)), typeCol, typeCol, logTypeConsume))
+		args = append(args, config.LogsRollupBefore)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// logsWindowConds 返回 --logs-since/--logs-until 对源表 created_at 的条件
+func logsWindowConds(tm TableMapping, driver string, first int) ([]string, []any) {
+	if tm.Target != "logs" {
+		return nil, nil
+	}
+	col := quoteIdent(driver, tm.sourceColumnFor("created_at"))
+	var conds []string
+	var args []any
+	if config.LogsSince > 0 {
+		conds = append(conds, fmt.Sprintf("%s >= %s", col, placeholderAt(driver, first+len(args))))
+		args = append(args, config.LogsSince)
+	}
+	if config.LogsUntil > 0 {
+		conds = append(conds, fmt.Sprintf("%s < %s", col, placeholderAt(driver, first+len(args))))
+		args = append(args, config.LogsUntil)
+	}
+	return conds, args
+}
+
+// withLogsFilter 在不带 WHERE 的查询后追加 logsFilter 的条件
+func withLogsFilter(query string, tm TableMapping, driver string) (string, []any) {
+	filter, args := logsFilter(tm, driver, 1)
+	if filter == "" {
+		return query, nil
+	}
+	return query + " WHERE " + filter, args
+}
+
+// transformLogStream 把 one-hub 的 is_stream（MySQL/SQLite 中为 0/1）统一为布尔值
+func transformLogStream(ctx *transformContext, value any) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	s := strings.ToLower(strings.TrimSpace(valueString(value)))
+	return s == "1" || s == "true" || s == "t", nil
+}
+
+// transformLogContent 把 one-hub logs.metadata（缓存、推理、音频 token 等明细）附加到 content 后，
+// one-api 的日志没有对应的列
+func transformLogContent(ctx *transformContext, value any) (any, error) {
+	raw, _ := ctx.Source("metadata")
+	text := strings.TrimSpace(valueString(raw))
+	if text == "" || text == "{}" || text == "null" {
+		return value, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(text), &fields); err != nil || len(fields) == 0 {
+		return value, nil
+	}
+	compact, err := json.Marshal(fields)
+	if err != nil {
+		return value, nil
+	}
+	content := valueString(value)
+	if content != "" {
+		content += " "
+	}
+	return content + "[one-hub metadata] " + string(compact), nil
+}
+
+// logTypeConsume 是 one-hub 与 one-api 中消费日志的 type，one-api 按它统计用户与模型的用量
+const logTypeConsume = 2
+
+// logsRollupZero 是汇总行中无法保留的源列（令牌、渠道、耗时等）的取值
+var logsRollupZero = map[string]any{
+	"token_name":   "",
+	"token_id":     0,
+	"channel_id":   0,
+	"request_time": 0,
+	"elapsed_time": 0,
+	"is_stream":    false,
+	"request_id":   "",
+	"metadata":     nil,
+}
+
+// logsRollupEnabled 表示表 tm 是否按 --logs-rollup-before 汇总旧日志，汇总行使用组内最小的 id，要求主键为 id
+func logsRollupEnabled(tm TableMapping) bool {
+	return tm.Target == "logs" && config.LogsRollupBefore > 0 && len(tm.Key) == 1 && tm.Key[0] == "id"
+}
+
+// logsRollupQuery 返回读取待汇总日志的查询：--logs-rollup-before 之前（且在 --logs-since/--logs-until 范围内）的消费日志，按 id 排序
+func logsRollupQuery(tm TableMapping, columns []string, driver string) (string, []any) {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdent(driver, col)
+	}
+	conds, args := logsWindowConds(tm, driver, 1)
+	conds = append(conds,
+		fmt.Sprintf("%s < %s", quoteIdent(driver, tm.sourceColumnFor("created_at")), placeholderAt(driver, len(args)+1)),
+		fmt.Sprintf("%s = %d", quoteIdent(driver, tm.sourceColumnFor("type")), logTypeConsume))
+	args = append(args, config.LogsRollupBefore)
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s", strings.Join(quoted, ", "), quoteIdent(driver, tm.Source),
+		strings.Join(conds, " AND "), quoteIdent(driver, tm.sourceColumnFor("id"))), args
+}
+
+// 汇总时各列的取值方式
+const (
+	rollupFirst = iota // 分组键与 id：取组内第一行（id 最小）的值
+	rollupDay          // created_at：当天零点
+	rollupSum          // 额度与 token 数：求和
+	rollupNull         // content 与 logsRollupZero 中的列：由 rollupRow 填写
+	rollupMax          // 其余列：取最大值
+)
+
+// readLogsRollup 读取待汇总的消费日志，按用户、模型与 logsLocation 时区的自然日分组。每行按自己所在日期的零点归入分组，
+// 夏令时切换的日子也不会错位，因此在 Go 中汇总而不是用固定的时区偏移 GROUP BY。
+// 每组一行：前 len(columns) 列与 columns 一一对应，id 取组内最小的 id，created_at 为当天零点，额度与 token 数求和，
+// 最后一列是组内的日志条数；结果按 id 排序
+func readLogsRollup(db *sql.DB, driver string, tm TableMapping, columns []string) ([][]any, error) {
+	kinds := make([]int, len(columns))
+	userCol, modelCol, dayCol := -1, -1, -1
+	for i, col := range columns {
+		switch col {
+		case tm.sourceColumnFor("user_id"):
+			userCol = i
+		case tm.sourceColumnFor("model_name"):
+			modelCol = i
+		case tm.sourceColumnFor("created_at"):
+			dayCol, kinds[i] = i, rollupDay
+		case tm.sourceColumnFor("id"):
+		case tm.sourceColumnFor("quota"), tm.sourceColumnFor("prompt_tokens"), tm.sourceColumnFor("completion_tokens"):
+			kinds[i] = rollupSum
+		case tm.sourceColumnFor("content"):
+			kinds[i] = rollupNull
+		default:
+			if _, ok := logsRollupZero[col]; ok {
+				kinds[i] = rollupNull
+			} else {
+				kinds[i] = rollupMax
+			}
+		}
+	}
+
+	query, args := logsRollupQuery(tm, columns, driver)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	raw := make([]any, len(columns))
+	ptrs := make([]any, len(raw))
+	for i := range raw {
+		ptrs[i] = &raw[i]
+	}
+	var groups [][]any
+	index := make(map[string]int)
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		var day int64
+		if dayCol != -1 {
+			ts, err := toInt64(raw[dayCol])
+			if err != nil {
+				return nil, fmt.Errorf("无法解析 created_at: %w", err)
+			}
+			y, m, d := time.Unix(ts, 0).In(logsLocation).Date()
+			day = time.Date(y, m, d, 0, 0, 0, 0, logsLocation).Unix()
+		}
+		key := fmt.Sprintf("%s\x1f%s\x1f%d", rollupKeyPart(raw, userCol), rollupKeyPart(raw, modelCol), day)
+		g, ok := index[key]
+		if !ok {
+			row := make([]any, len(columns)+1)
+			for i, kind := range kinds {
+				switch kind {
+				case rollupFirst, rollupMax:
+					row[i] = raw[i]
+				case rollupDay:
+					row[i] = day
+				case rollupSum:
+					row[i] = int64(0)
+				}
+			}
+			row[len(columns)] = int64(0)
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, row)
+		}
+		row := groups[g]
+		for i, kind := range kinds {
+			switch kind {
+			case rollupSum:
+				if raw[i] != nil {
+					n, err := toInt64(raw[i])
+					if err != nil {
+						return nil, fmt.Errorf("无法汇总 %s: %w", columns[i], err)
+					}
+					row[i] = row[i].(int64) + n
+				}
+			case rollupMax:
+				row[i] = maxValue(row[i], raw[i])
+			}
+		}
+		row[len(columns)] = row[len(columns)].(int64) + 1
+	}
+	return groups, rows.Err()
+}
+
+func rollupKeyPart(raw []any, i int) string {
+	if i == -1 {
+		return ""
+	}
+	return valueString(raw[i])
+}
+
+// maxValue 返回两个值中较大的一个（与 SQL 的 MAX 相同，忽略 NULL）：都是整数时按数值比较，否则按字符串比较
+func maxValue(a, b any) any {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	x, errA := toInt64(a)
+	y, errB := toInt64(b)
+	if errA == nil && errB == nil {
+		if y > x {
+			return b
+		}
+		return a
+	}
+	if valueString(b) > valueString(a) {
+		return b
+	}
+	return a
+}
+
+// rollupRow 把 readLogsRollup 汇总的一行补全为源表的一行：content 记录汇总的日期与条数，无法汇总的列按 logsRollupZero 填写
+func rollupRow(tm TableMapping, columns []string, raw []any) []any {
+	values := append([]any(nil), raw[:len(columns)]...)
+	count := valueString(raw[len(columns)])
+	day := ""
+	if i := indexOf(columns, tm.sourceColumnFor("created_at")); i != -1 {
+		if ts, err := toInt64(values[i]); err == nil {
+			day = time.Unix(ts, 0).In(logsLocation).Format("2006-01-02")
+		}
+	}
+	for i, col := range columns {
+		if col == tm.sourceColumnFor("content") {
+			values[i] = fmt.Sprintf("one-hub 日志汇总：%s 共 %s 条消费记录", day, count)
+			continue
+		}
+		if zero, ok := logsRollupZero[col]; ok {
+			values[i] = zero
+		}
+	}
+	return values
+}
+
+// copyRollup 把 --logs-rollup-before 之前的消费日志汇总为每个用户、模型每天一行后写入目标库，
+// 额度与 token 数求和，one-api 按日志统计的用户用量不变。在单个事务中完成，断点记录后续传时不再重复
+func (run *tableCopy) copyRollup() error {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+	tm, cols := run.tm, run.cols
+	table := tm.name()
+
+	groups, err := readLogsRollup(run.oldDB, oldDriver, tm, cols.SourceColumns)
+	if err != nil {
+		return fmt.Errorf("汇总源库表 %s 失败: %w", tm.Source, err)
+	}
+
+	tx, err := run.newDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	batcher := newInsertBatcher(tx, tm.Target, cols.targetNames(), newDriver, run.limits, run.policy)
+	var sourceRows, written int64
+	for _, raw := range groups {
+		n, _ := toInt64(raw[len(cols.SourceColumns)])
+		sourceRows += n
+		run.read.Add(1)
+		values, err := buildInsertValues(rollupRow(tm, cols.SourceColumns, raw), cols, tm.Target, convertOptions{Issues: run.issues})
+		switch {
+		case errors.Is(err, errSkipRow):
+			run.skipped.Add(1)
+			continue
+		case err != nil:
+			_ = tx.Rollback()
+			return fmt.Errorf("转换表 %s 的汇总行失败: %w", table, err)
+		}
+		if err := batcher.add(values); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("插入新库表 %s 失败: %w", tm.Target, err)
+		}
+		written++
+	}
+	if err := batcher.flush(); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("插入新库表 %s 失败: %w", tm.Target, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	run.count.Add(written)
+	run.written.Add(written)
+	if err := run.cp.update(table, func(t *tableCheckpoint) { t.RolledUp = true }); err != nil {
+		fmt.Fprintf(console, "⚠️ 写入断点文件失败: %v\n", err)
+	}
+	logEvent("logs_rolled_up", eventFields{"table": table, "before": config.LogsRollupBefore, "source_rows": sourceRows, "rows": written},
+		"🧮 表 %s 中 %s 之前的 %d 条消费日志已汇总为 %d 行（每个用户、模型每天一行）\n",
+		table, time.Unix(config.LogsRollupBefore, 0).In(logsLocation).Format("2006-01-02 15:04:05"), sourceRows, written)
+	return nil
+}
+
+// planLogsRollup 统计将被汇总的消费日志条数与生成的汇总行数
+func planLogsRollup(oldDB *sql.DB, tm TableMapping) (sourceRows, rows int64, err error) {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	var columns []string
+	for _, col := range []string{"id", "user_id", "model_name", "created_at"} {
+		columns = append(columns, tm.sourceColumnFor(col))
+	}
+	groups, err := readLogsRollup(oldDB, oldDriver, tm, columns)
+	for _, g := range groups {
+		n, _ := toInt64(g[len(columns)])
+		sourceRows += n
+	}
+	return sourceRows, int64(len(groups)), err
+}
+
+// verifyLogsRollup 按迁移时相同的方式重新汇总源库，与目标库中早于 --logs-rollup-before 的消费日志按 id 比较
+func verifyLogsRollup(oldDB, newDB *sql.DB, tm TableMapping) tableVerification {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+
+	result := tableVerification{Table: tm.name() + "（汇总）", byID: true}
+	cols, ok := resolveVerifyTable(oldDB, newDB, tm, &result)
+	if !ok {
+		return result
+	}
+	if !contains(result.Columns, "id") {
+		result.Error = "没有可用于比较的主键"
+		return result
+	}
+
+	groups, err := readLogsRollup(oldDB, oldDriver, tm, cols.SourceColumns)
+	if err != nil {
+		result.Error = fmt.Sprintf("汇总源库失败: %v", err)
+		return result
+	}
+	src := verifySide{
+		rows: groups,
+		convert: func(raw []any) ([]any, error) {
+			return buildInsertValues(rollupRow(tm, cols.SourceColumns, raw), cols, tm.Target, convertOptions{})
+		},
+	}
+	dst := verifySide{db: newDB, driver: newDriver, table: tm.Target, columns: result.Columns, orderBy: "id"}
+	dst.where, dst.args = logsRollupTarget(newDriver, false)
+	if err := verifyByID(src, dst, &result); err != nil {
+		result.Error = fmt.Sprintf("校验失败: %v", err)
+	}
+	return result
+}
+
+// logsRollupTarget 返回目标库 logs 中汇总行所在范围（早于 --logs-rollup-before 的消费日志）的条件，
+// exclude 为 true 时返回该范围之外的条件
+func logsRollupTarget(driver string, exclude bool) (string, []any) {
+	cond := fmt.Sprintf("%s < %s AND %s = %d", quoteIdent(driver, "created_at"), placeholderAt(driver, 1), quoteIdent(driver, "type"), logTypeConsume)
+	if exclude {
+		cond = "NOT (" + cond + ")"
+	}
+	return cond, []any{config.LogsRollupBefore}
+}
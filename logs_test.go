@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogsTime(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	defer func(l *time.Location) { logsLocation = l }(logsLocation)
+	logsLocation = loc
+	tests := []struct {
+		in      string
+		end     bool
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "", want: time.Unix(0, 0)},
+		{in: " ", end: true, want: time.Unix(0, 0)},
+		{in: "2024-03-01", want: time.Date(2024, 3, 1, 0, 0, 0, 0, loc)},
+		{in: "2024-03-01", end: true, want: time.Date(2024, 3, 2, 0, 0, 0, 0, loc)},
+		{in: "2024-12-31", end: true, want: time.Date(2025, 1, 1, 0, 0, 0, 0, loc)},
+		{in: "2024-03-01 08:30:00", end: true, want: time.Date(2024, 3, 1, 8, 30, 0, 0, loc)},
+		{in: "2024-03-01T08:30:00", want: time.Date(2024, 3, 1, 8, 30, 0, 0, loc)},
+		{in: "2024-03-01T08:30:00Z", want: time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)},
+		{in: "2024-03-01T08:30:00-05:00", end: true, want: time.Date(2024, 3, 1, 13, 30, 0, 0, time.UTC)},
+		{in: "0d", wantErr: true},
+		{in: "-3d", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "2024-13-01", wantErr: true},
+		{in: "2024/03/01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseLogsTime(tt.in, tt.end)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseLogsTime(%q) 应返回错误", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want.Unix() {
+				t.Errorf("parseLogsTime(%q, %v) = %s, want %s", tt.in, tt.end, time.Unix(got, 0).In(loc), tt.want.In(loc))
+			}
+		})
+	}
+}
+
+func TestParseLogsTimeRelative(t *testing.T) {
+	before := time.Now().AddDate(0, 0, -90).Unix()
+	got, err := parseLogsTime("90d", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().AddDate(0, 0, -90).Unix()
+	if got < before || got > after {
+		t.Errorf("parseLogsTime(90d) = %d，应在 [%d, %d] 之间", got, before, after)
+	}
+}
+
+func TestParseLogsWindow(t *testing.T) {
+	tests := []struct {
+		since, until string
+		wantErr      string
+	}{
+		{since: "2024-01-01", until: "2024-01-01"},
+		{since: "2024-01-01", until: ""},
+		{since: "", until: "2024-01-01"},
+		{since: "2024-01-02", until: "2024-01-01", wantErr: "应早于"},
+		{since: "2024-01-01 12:00:00", until: "2024-01-01 12:00:00", wantErr: "应早于"},
+		{since: "abc", wantErr: "--logs-since"},
+		{until: "abc", wantErr: "--logs-until"},
+	}
+	for _, tt := range tests {
+		_, _, err := parseLogsWindow(tt.since, tt.until)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("parseLogsWindow(%q, %q): %v", tt.since, tt.until, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseLogsWindow(%q, %q) error = %v, want 包含 %q", tt.since, tt.until, err, tt.wantErr)
+		}
+	}
+}
+
+// 夏令时切换的日子每行按自己所在日期的零点归入分组：2024-03-10 只有 23 小时，2024-11-03 有 25 小时
+func TestReadLogsRollupDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("没有时区数据: %v", err)
+	}
+	defer func(l *time.Location) { logsLocation = l }(logsLocation)
+	logsLocation = loc
+	mapping = defaultMapping()
+	config = Config{LogsRollupBefore: time.Date(2025, 1, 1, 0, 0, 0, 0, loc).Unix()}
+	t.Cleanup(func() { config = Config{} })
+
+	at := func(month time.Month, day, hour, min int) int64 {
+		return time.Date(2024, month, day, hour, min, 0, 0, loc).Unix()
+	}
+	logs := []struct {
+		userID    int
+		model     string
+		createdAt int64
+		logType   int
+		quota     int
+	}{
+		{1, "gpt-4", at(3, 10, 0, 30), logTypeConsume, 1},
+		{1, "gpt-4", at(3, 10, 23, 30), logTypeConsume, 2},
+		{1, "gpt-4", at(3, 11, 0, 30), logTypeConsume, 4},
+		{2, "gpt-4", at(3, 10, 12, 0), logTypeConsume, 8},
+		{1, "gpt-4", at(11, 2, 23, 45), logTypeConsume, 16},
+		{1, "gpt-4", at(11, 3, 0, 30), logTypeConsume, 32},
+		{1, "gpt-4", at(11, 3, 23, 30), logTypeConsume, 64},
+		{1, "gpt-4", at(11, 4, 0, 15), logTypeConsume, 128},
+		{1, "claude-3", at(11, 3, 1, 30), logTypeConsume, 256},
+		{1, "gpt-4", at(11, 3, 12, 0), 1, 512},
+		{1, "gpt-4", time.Date(2025, 1, 1, 0, 0, 0, 0, loc).Unix(), logTypeConsume, 1024},
+	}
+	path := t.TempDir() + "/src.db"
+	execSQL(t, path, "CREATE TABLE logs (id integer primary key, user_id integer, created_at integer, type integer, content text, model_name text, quota integer, prompt_tokens integer)")
+	db := openTestDB(t, path)
+	for i, l := range logs {
+		if _, err := db.Exec("INSERT INTO logs VALUES (?,?,?,?,?,?,?,?)", i+1, l.userID, l.createdAt, l.logType, "c", l.model, l.quota, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tm, _ := mapping.tableFor("logs")
+	columns := []string{"id", "user_id", "created_at", "model_name", "content", "quota", "prompt_tokens"}
+	got, err := readLogsRollup(db, "sqlite", tm, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	midnight := func(month time.Month, day int) int64 {
+		return time.Date(2024, month, day, 0, 0, 0, 0, loc).Unix()
+	}
+	want := [][]any{
+		{int64(1), int64(1), midnight(3, 10), "gpt-4", nil, int64(3), int64(2), int64(2)},
+		{int64(3), int64(1), midnight(3, 11), "gpt-4", nil, int64(4), int64(1), int64(1)},
+		{int64(4), int64(2), midnight(3, 10), "gpt-4", nil, int64(8), int64(1), int64(1)},
+		{int64(5), int64(1), midnight(11, 2), "gpt-4", nil, int64(16), int64(1), int64(1)},
+		{int64(6), int64(1), midnight(11, 3), "gpt-4", nil, int64(96), int64(2), int64(2)},
+		{int64(8), int64(1), midnight(11, 4), "gpt-4", nil, int64(128), int64(1), int64(1)},
+		{int64(9), int64(1), midnight(11, 3), "claude-3", nil, int64(256), int64(1), int64(1)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("汇总为 %d 行，应为 %d 行: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if normalizeValue(got[i][j]) != normalizeValue(want[i][j]) {
+				t.Errorf("第 %d 行 = %v, want %v", i+1, got[i], want[i])
+				break
+			}
+		}
+	}
+
+	row := rollupRow(tm, columns, got[4])
+	if content := valueString(row[4]); !strings.Contains(content, "2024-11-03 共 2 条") {
+		t.Errorf("汇总行的 content = %q，应记录日期 2024-11-03 与条数 2", content)
+	}
+}
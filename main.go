@@ -3,94 +3,452 @@ package main
 import (
 	"database/sql"
 	"encoding/binary"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/url"
 	"os"
-	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	_ "modernc.org/sqlite"
 )
 
+// 进程退出码，供自动化脚本区分失败原因
+const (
+	exitOK = 0
+	// exitUsage 表示参数、配置或迁移规则有误
+	exitUsage = 1
+	// exitTablesFailed 表示部分表迁移失败（已提交的数据与断点保留）
+	exitTablesFailed = 2
+	// exitConnectionFailed 表示无法连接源库或目标库
+	exitConnectionFailed = 3
+	// exitVerifyFailed 表示迁移后的校验未通过
+	exitVerifyFailed = 4
+	// exitPreflightFailed 表示预检未通过（同一个库、缺表或没有写入权限），未写入任何数据
+	exitPreflightFailed = 5
+)
+
 type Config struct {
 	OldDSN string
 	NewDSN string
+	// DryRun 为 true 时只读取两端数据库并输出迁移计划，不写入目标库
+	DryRun bool
+	// BatchSize 是 migrateTable 单条多行 INSERT 的行数上限（还会受驱动占位符/报文大小限制）
+	BatchSize int
+	// ChunkSize 是可续传的表每次提交事务的行数
+	ChunkSize int
+	// CheckpointFile 是断点文件路径，为空时不记录断点
+	CheckpointFile string
+	// Restart 为 true 时丢弃已有断点，从头迁移
+	Restart bool
+	// Verify 为 true 时在迁移结束后校验源库与目标库的数据
+	Verify bool
+	// VerifyOnly 为 true 时跳过迁移，只执行校验
+	VerifyOnly bool
+	// Conflict 是写入目标库时的主键/唯一键冲突策略
+	Conflict conflictPolicies
+	// MappingFile 是 JSON 格式的迁移规则文件，为空时使用内置的 one-hub -> one-api 规则
+	MappingFile string
+	// ChannelFallback 是 channelMap 中没有对应类型的源渠道的处理方式
+	ChannelFallback channelFallbacks
+	// Workers 是并发复制数据的 goroutine 数，大于 1 时表之间并发、大表按 id 区间拆分
+	Workers int
+	// FailFast 为 true 时第一张表失败后停止迁移其余表
+	FailFast bool
+	// SkipPreflight 为 true 时跳过迁移前的预检
+	SkipPreflight bool
+	// TargetMode 决定目标库表已有数据时的处理方式；AssumeYes 为 true 时清空目标库不再询问
+	TargetMode targetMode
+	AssumeYes  bool
+	// BackupDir 非空时在写入前把目标库表备份到该目录，BackupFormat 为 jsonl 或 sql
+	BackupDir    string
+	BackupFormat string
+	// IDOffsets 是合并模式下 --id-offset 指定的偏移量，IDMapFile 是导出新旧 id 对照的文件
+	IDOffsets map[string]int64
+	IDMapFile string
+	// UserCollision 是源库用户与目标库已有用户冲突时的处理方式，rename 时用户名加 UserRenameSuffix
+	UserCollision    string
+	UserRenameSuffix string
+	// RemergeQuotas 为 true 时，目标库中已记录合并过的用户仍再次累加额度
+	RemergeQuotas bool
+	// LogFormat 为 text（默认）或 json；SummaryFile 非空时把运行汇总写入该文件
+	LogFormat   string
+	SummaryFile string
+	// RebuildAbilities 为 true 时迁移结束后从目标库 channels 重建 abilities
+	RebuildAbilities bool
+	// ResetSequences 为 true 时迁移结束后把目标库的自增序列调整到 max(id)+1
+	ResetSequences bool
+	// MigratePrices 为 true 时把 one-hub prices 表转换为目标库的 ModelRatio/CompletionRatio
+	MigratePrices bool
+	// OptionsPolicy 决定源库配置项是否覆盖目标库已设置的值（keep/overwrite），同样用于合并倍率配置
+	OptionsPolicy string
+	// MigrateGroups 为 true 时把 one-hub user_groups 表转换为目标库的 GroupRatio 并检查分组引用
+	MigrateGroups bool
+	// SkipLogs 为 true 时不迁移 logs；LogsSince/LogsUntil 非 0 时只迁移 created_at 在 [LogsSince, LogsUntil) 内的日志
+	SkipLogs  bool
+	LogsSince int64
+	LogsUntil int64
+	// LogsRollupBefore 非 0 时早于该时间的消费日志汇总为每个用户、模型每天一行，之后的日志逐行复制
+	LogsRollupBefore int64
+	// ChannelTypes 是命令行/环境变量指定的渠道类型映射（one-hub 类型 -> one-api 类型），优先于规则文件
+	ChannelTypes channelTypeFlag
+}
+
+// channelTypeFlag 收集可重复的 --channel-type 源类型=目标类型 参数
+type channelTypeFlag map[int]int
+
+func (f channelTypeFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for src, dst := range f {
+		pairs = append(pairs, fmt.Sprintf("%d=%d", src, dst))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f channelTypeFlag) Set(value string) error {
+	for _, item := range splitCSVTrim(value) {
+		src, dst, err := parseChannelTypeOverride(item)
+		if err != nil {
+			return err
+		}
+		f[src] = dst
+	}
+	return nil
 }
 
 var config Config
 
 func main() {
-	if len(os.Args) > 2 {
+	cmd, args := parseCommand(os.Args[1:])
+	config.ChannelTypes = make(channelTypeFlag)
+	if err := config.ChannelTypes.Set(stringEnv("ONEAPI_CHANNEL_TYPES", "")); err != nil {
+		log.Fatalf("⚠️ ONEAPI_CHANNEL_TYPES: %v", err)
+	}
+	fs := newFlagSet(cmd)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitUsage)
+	}
 
-		config.OldDSN = os.Args[1]
-		config.NewDSN = os.Args[2]
-	} else {
-		fmt.Println("⚠️命令参数中未查询到数据库连接信息，将从环境变量获取⚠️")
-		fmt.Println("⚠️环境变量ONEAPI_SOURCE_SQL_DSN:MartialBE/one-hub数据库的连接字符串(源)⚠️")
-		fmt.Println("⚠️环境变量ONEAPI_TARGET_SQL_DSN:songquanpeng/one-api数据库的连接字符串(目标)⚠️")
-		config = loadConfig()
+	if err := setupConfig(); err != nil {
+		log.Fatalf("⚠️ %v", err)
+	}
+	if options.dumpMapping {
+		if err := printMapping(mapping); err != nil {
+			log.Fatalf("⚠️ %v", err)
+		}
+		return
+	}
+	if err := setupEvents(config.LogFormat); err != nil {
+		log.Fatalf("⚠️ %v", err)
+	}
+	overrides := mapping.channelTypeOverrides()
+	for src, dst := range config.ChannelTypes {
+		overrides[src] = dst
+	}
+	if err := applyChannelTypeOverrides(overrides); err != nil {
+		log.Fatalf("⚠️ %v", err)
+	}
+
+	if err := resolveDSNs(cmd, fs.Args()); err != nil {
+		fmt.Fprintf(console, "⚠️ %v\n", err)
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	os.Exit(cmd.run())
+}
+
+// runMigrate 是 migrate 子命令：迁移所有表、重建 abilities，可选迁移后校验
+func runMigrate() int {
+	if config.DryRun {
+		return runPlan()
+	}
+	if config.VerifyOnly {
+		return runVerify()
 	}
 
 	oldDB := openDatabase(config.OldDSN)
 	newDB := openDatabase(config.NewDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+	detectUpsertSyntax(newDB, newDriver)
+
+	cp, err := loadCheckpoint(config.CheckpointFile, config.Restart)
+	if err != nil {
+		log.Fatalf("⚠️ %v", err)
+	}
+	if config.TargetMode == targetTruncate && len(cp.Tables) > 0 {
+		fmt.Fprintf(console, "⚠️ 断点文件 %s 中有未完成的迁移，--truncate-target 会清空已迁移的数据；如需从头迁移请同时使用 --restart\n", config.CheckpointFile)
+		return exitPreflightFailed
+	}
+	if !config.SkipPreflight {
+		if err := preflight(oldDB, newDB, cp, false); err != nil {
+			return exitPreflightFailed
+		}
+		fmt.Fprintln(console, "======================")
+	}
+	var backupPath string
+	if config.BackupDir != "" {
+		if backupPath, err = backupTarget(newDB, config.BackupDir, config.BackupFormat); err != nil {
+			fmt.Fprintf(console, "⛔ %v，未写入任何数据\n", err)
+			return exitPreflightFailed
+		}
+		logEvent("backup_done", eventFields{"path": backupPath, "format": config.BackupFormat},
+			"💾 目标库已备份到 %s，恢复命令: %s restore --from %s --target <目标DSN>\n", backupPath, os.Args[0], backupPath)
+		fmt.Fprintln(console, "======================")
+	}
+	if config.TargetMode == targetMerge {
+		if ids, err = setupMerge(newDB, cp, config.IDOffsets, true); err != nil {
+			fmt.Fprintf(console, "⛔ %v\n", err)
+			return exitPreflightFailed
+		}
+		fmt.Fprintln(console, "======================")
+	}
+	if config.TargetMode == targetTruncate {
+		if err := truncateTarget(newDB, config.AssumeYes); err != nil {
+			fmt.Fprintf(console, "⛔ %v\n", err)
+			return exitPreflightFailed
+		}
+	}
+	if err := setupUserCollisions(oldDB, newDB, cp, true); err != nil {
+		fmt.Fprintf(console, "⛔ 检测用户冲突失败: %v\n", err)
+		return exitPreflightFailed
+	}
+
+	if newDriver, _ := detectDriver(config.NewDSN); newDriver == "sqlite" && config.Workers > 1 {
+		// SQLite 同一时间只允许一个写事务，并发写入只会互相等待甚至报 database is locked
+		fmt.Fprintf(console, "ℹ️ 目标库为 SQLite，不支持并发写入，--workers %d 已调整为 1\n", config.Workers)
+		config.Workers = 1
+	}
+	workers = newWorkerPool(config.Workers)
+
+	fmt.Fprintln(console, "🚩数据处理开始🚩")
+	fmt.Fprintln(console, "======================")
+	summary := &runSummary{StartedAt: time.Now(), Workers: workers.size(), Backup: backupPath}
+	summary.Tables = migrateTables(oldDB, newDB, cp)
+	for _, t := range summary.Tables {
+		switch t.Status {
+		case "failed":
+			summary.FailedTables++
+		case "cancelled":
+			summary.CancelledTables++
+		}
+	}
+	// 失败或中止的表也可能已写入部分行，同样需要调整
+	if config.ResetSequences {
+		fmt.Fprintln(console, "======================")
+		resetSequences(newDB, idTables())
+	}
+	if (ids != nil || len(userCollisions) > 0) && config.IDMapFile != "" {
+		if err := writeIDMap(oldDB, config.IDMapFile); err != nil {
+			fmt.Fprintf(console, "⚠️ 导出 id 对照失败: %v\n", err)
+		} else {
+			logEvent("id_map_written", eventFields{"path": config.IDMapFile}, "🔀 源库 id 与目标库 id 的对照已写入 %s\n", config.IDMapFile)
+		}
+	}
+	if unfinished := summary.FailedTables + summary.CancelledTables; unfinished == 0 {
+		if err := cp.remove(); err != nil {
+			fmt.Fprintf(console, "⚠️ 删除断点文件失败: %v\n", err)
+		}
+	} else if config.CheckpointFile != "" {
+		fmt.Fprintf(console, "💾 %d 张表未完成，断点已保存到 %s，重新运行即可从断点继续\n", unfinished, config.CheckpointFile)
+	}
 
-	tables := []string{"channels", "logs", "options", "redemptions", "tokens", "users", "abilities"}
-	fmt.Println("🚩数据处理开始🚩")
-	fmt.Println("======================")
-	for _, table := range tables {
-		fmt.Printf("🚀 正在处理表: %s\n", table)
-		migrateTable(oldDB, newDB, table)
-		fmt.Printf("✅ 完成处理表: %s\n", table)
+	if stopMigration.Load() {
+		summary.ExitCode = exitTablesFailed
+		summary.finish()
+		writeRunSummary(summary, config.SummaryFile)
+		fmt.Fprintln(console, "======================")
+		fmt.Fprintln(console, "🚩数据处理已按 --fail-fast 中止，未重建 abilities、未执行校验🚩")
+		return summary.ExitCode
 	}
 
-	if boolEnvDefaultTrue("ONEAPI_REBUILD_ABILITIES") {
-		fmt.Println("======================")
-		fmt.Println("🔧 正在尝试重建目标库 abilities（从目标库 channels 派生）")
+	if config.RebuildAbilities {
+		fmt.Fprintln(console, "======================")
+		fmt.Fprintln(console, "🔧 正在尝试重建目标库 abilities（从目标库 channels 派生）")
 		rebuildTargetAbilitiesFromChannels(newDB)
 	}
-	fmt.Println("======================")
-	fmt.Println("🚩数据处理完成🚩")
+	if pricesEnabled() {
+		fmt.Fprintln(console, "======================")
+		fmt.Fprintln(console, "💰 正在迁移 one-hub 模型价格")
+		summary.Prices = "migrated"
+		if err := migratePrices(oldDB, newDB); err != nil {
+			fmt.Fprintf(console, "⚠️ 价格迁移失败，未修改 ModelRatio/CompletionRatio: %v\n", err)
+			summary.Prices = "failed"
+		}
+	}
+	if groupsEnabled() {
+		fmt.Fprintln(console, "======================")
+		fmt.Fprintln(console, "👪 正在迁移 one-hub 用户分组")
+		summary.Groups = "migrated"
+		missing, err := migrateGroups(oldDB, newDB)
+		if err != nil {
+			fmt.Fprintf(console, "⚠️ 分组迁移失败，未修改 GroupRatio: %v\n", err)
+			summary.Groups = "failed"
+		}
+		summary.MissingGroups = missing
+	}
+	if config.Verify {
+		summary.Verify = "passed"
+		if !verifyMigration(oldDB, newDB) {
+			summary.Verify = "failed"
+			summary.ExitCode = exitVerifyFailed
+		}
+	}
+	// 表失败优先于校验失败：校验失败往往只是表失败的结果
+	if summary.FailedTables > 0 || summary.Prices == "failed" || summary.Groups == "failed" {
+		summary.ExitCode = exitTablesFailed
+	}
+	summary.finish()
+	writeRunSummary(summary, config.SummaryFile)
+	fmt.Fprintln(console, "======================")
+	switch summary.ExitCode {
+	case exitTablesFailed:
+		if summary.FailedTables > 0 {
+			fmt.Fprintf(console, "🚩数据处理完成，但有 %d 张表迁移失败🚩\n", summary.FailedTables)
+		} else {
+			fmt.Fprintln(console, "🚩数据处理完成，但模型价格或用户分组迁移失败🚩")
+		}
+	case exitVerifyFailed:
+		fmt.Fprintln(console, "🚩数据处理完成，但校验未通过🚩")
+	default:
+		fmt.Fprintln(console, "🚩数据处理完成🚩")
+	}
+	return summary.ExitCode
+}
+
+// runPlan 是 plan 子命令
+func runPlan() int {
+	oldDB := openDatabase(config.OldDSN)
+	newDB := openDatabase(config.NewDSN)
+	// plan 只读取断点，--restart 时视为没有断点；断点文件无法读取时报告原因，按没有断点预览
+	cp, err := loadCheckpoint(config.CheckpointFile, false)
+	if err != nil {
+		fmt.Fprintf(console, "⚠️ %v，按没有断点预览\n", err)
+	}
+	if err != nil || config.Restart {
+		cp, _ = loadCheckpoint("", false)
+	}
+	if !config.SkipPreflight {
+		if err := preflight(oldDB, newDB, cp, true); err != nil {
+			return exitPreflightFailed
+		}
+		fmt.Fprintln(console, "======================")
+	}
+	if config.TargetMode == targetMerge {
+		if ids, err = setupMerge(newDB, cp, config.IDOffsets, false); err != nil {
+			fmt.Fprintf(console, "⛔ %v\n", err)
+			return exitPreflightFailed
+		}
+		fmt.Fprintln(console, "======================")
+	}
+	if err := setupUserCollisions(oldDB, newDB, cp, false); err != nil {
+		fmt.Fprintf(console, "⛔ 检测用户冲突失败: %v\n", err)
+		return exitPreflightFailed
+	}
+	planMigration(oldDB, newDB, cp)
+	return exitOK
 }
 
-func boolEnvDefaultTrue(name string) bool {
+// runVerify 是 verify 子命令，校验未通过时返回非 0
+func runVerify() int {
+	if config.TargetMode == targetMerge && ids == nil {
+		if err := loadIDMap(config.IDMapFile, true); err != nil {
+			fmt.Fprintf(console, "⚠️ 合并模式的校验需要迁移时导出的 id 对照（--id-map-file）: %v\n", err)
+			return exitUsage
+		}
+	} else if userCollisions == nil && config.IDMapFile != "" {
+		// 非合并模式下对照文件只在有用户冲突时导出，校验时沿用其中的处理方式
+		if err := loadIDMap(config.IDMapFile, false); err == nil && len(userCollisions) > 0 {
+			fmt.Fprintf(console, "ℹ️ 按 %s 中记录的 %d 个用户冲突的处理方式校验\n", config.IDMapFile, len(userCollisions))
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(console, "⚠️ %v\n", err)
+		}
+	}
+	if !verifyMigration(openDatabase(config.OldDSN), openDatabase(config.NewDSN)) {
+		return exitVerifyFailed
+	}
+	return exitOK
+}
+
+// runRebuildAbilities 是 rebuild-abilities 子命令，只需要目标库
+func runRebuildAbilities() int {
+	fmt.Fprintln(console, "🔧 正在尝试重建目标库 abilities（从目标库 channels 派生）")
+	newDB := openDatabase(config.NewDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+	detectUpsertSyntax(newDB, newDriver)
+	rebuildTargetAbilitiesFromChannels(newDB)
+	return exitOK
+}
+
+// boolEnv 读取布尔型环境变量，未设置或为空时返回 def
+func boolEnv(name string, def bool) bool {
 	val, ok := os.LookupEnv(name)
 	if !ok {
-		return true
+		return def
 	}
 	val = strings.TrimSpace(strings.ToLower(val))
 	if val == "" {
-		return true
+		return def
 	}
 	switch val {
-	case "0", "false", "no", "off" :
+	case "0", "false", "no", "off":
 		return false
-	default:
+	case "1", "true", "yes", "on":
 		return true
+	default:
+		return def
 	}
 }
 
+// stringEnv 读取字符串环境变量，未设置时返回 def
+func stringEnv(name string, def string) string {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	return strings.TrimSpace(val)
+}
+
+// intEnv 读取整型环境变量，未设置或无法解析时返回 def
+func intEnv(name string, def int) int {
+	val := strings.TrimSpace(os.Getenv(name))
+	if val == "" {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		fmt.Fprintf(console, "⚠️ 环境变量 %s=%q 不是整数，使用默认值 %d\n", name, val, def)
+		return def
+	}
+	return n
+}
+
 func rebuildTargetAbilitiesFromChannels(newDB *sql.DB) {
 	newDriver, _ := detectDriver(config.NewDSN)
 	abilityCols := getColumns(newDB, "abilities", newDriver)
 	if len(abilityCols) == 0 {
-		fmt.Println("⚠️ 目标库中没有找到表: abilities，跳过重建")
+		fmt.Fprintln(console, "⚠️ 目标库中没有找到表: abilities，跳过重建")
 		return
 	}
 
 	channelCols := getColumns(newDB, "channels", newDriver)
 	if len(channelCols) == 0 {
-		fmt.Println("⚠️ 目标库中没有找到表: channels，无法重建 abilities")
+		fmt.Fprintln(console, "⚠️ 目标库中没有找到表: channels，无法重建 abilities")
 		return
 	}
 
 	required := []string{"id", "group", "models", "status"}
 	for _, col := range required {
 		if !contains(channelCols, col) {
-			fmt.Printf("⚠️ 目标库 channels 缺少字段 %s，跳过重建 abilities\n", col)
+			fmt.Fprintf(console, "⚠️ 目标库 channels 缺少字段 %s，跳过重建 abilities\n", col)
 			return
 		}
 	}
@@ -112,17 +470,22 @@ func rebuildTargetAbilitiesFromChannels(newDB *sql.DB) {
 
 	rows, err := newDB.Query(query)
 	if err != nil {
-		fmt.Printf("⚠️ 查询目标库 channels 失败，无法重建 abilities: %v\n", err)
+		fmt.Fprintf(console, "⚠️ 查询目标库 channels 失败，无法重建 abilities: %v\n", err)
 		return
 	}
 	defer rows.Close()
 
 	insertColumns := []string{"group", "model", "channel_id", "enabled", "priority"}
 	const maxBatchRows = 500
+	policy := config.Conflict.forTable("abilities")
+	if err := checkConflictKeys("abilities", policy, insertColumns); err != nil {
+		fmt.Fprintf(console, "⚠️ %v，跳过重建 abilities\n", err)
+		return
+	}
 
 	tx, err := newDB.Begin()
 	if err != nil {
-		fmt.Printf("⚠️ 开启事务失败（重建 abilities）: %v\n", err)
+		fmt.Fprintf(console, "⚠️ 开启事务失败（重建 abilities）: %v\n", err)
 		return
 	}
 
@@ -130,7 +493,7 @@ func rebuildTargetAbilitiesFromChannels(newDB *sql.DB) {
 		if batchRows == 0 {
 			return nil
 		}
-		insertSQL := buildBulkInsertSQL("abilities", insertColumns, newDriver, batchRows)
+		insertSQL := buildBulkInsertSQL("abilities", insertColumns, newDriver, batchRows, policy)
 		_, err := tx.Exec(insertSQL, batchArgs...)
 		return err
 	}
@@ -153,18 +516,15 @@ func rebuildTargetAbilitiesFromChannels(newDB *sql.DB) {
 		err := rows.Scan(&channelID, &group, &models, &status, &priority)
 		if err != nil {
 			_ = tx.Rollback()
-			fmt.Printf("⚠️ 扫描目标库 channels 失败，重建 abilities 中止: %v\n", err)
+			fmt.Fprintf(console, "⚠️ 扫描目标库 channels 失败，重建 abilities 中止: %v\n", err)
 			return
 		}
 		seenRows++
 
-		groups := splitCSVTrim(group.String)
-		modelsList := splitCSVTrim(models.String)
-		if len(groups) == 0 || len(modelsList) == 0 {
+		pairs := channelAbilities(group.String, models.String)
+		if len(pairs) == 0 {
 			continue
 		}
-		groups = dedupStrings(groups)
-		modelsList = dedupStrings(modelsList)
 
 		enabled := status.Valid && status.Int64 == 1
 		var prio any
@@ -174,41 +534,52 @@ func rebuildTargetAbilitiesFromChannels(newDB *sql.DB) {
 			prio = nil
 		}
 
-		for _, g := range groups {
-			for _, m := range modelsList {
-				batchArgs = append(batchArgs, g, m, channelID, enabled, prio)
-				batchRows++
-				inserted++
-				if batchRows >= maxBatchRows {
-					err := flush(batchArgs, batchRows)
-					if err != nil {
-						_ = tx.Rollback()
-						fmt.Printf("⚠️ 重建 abilities 批量写入失败: %v\n", err)
-						return
-					}
-					batchArgs = batchArgs[:0]
-					batchRows = 0
+		for _, pair := range pairs {
+			batchArgs = append(batchArgs, pair[0], pair[1], channelID, enabled, prio)
+			batchRows++
+			inserted++
+			if batchRows >= maxBatchRows {
+				err := flush(batchArgs, batchRows)
+				if err != nil {
+					_ = tx.Rollback()
+					fmt.Fprintf(console, "⚠️ 重建 abilities 批量写入失败: %v\n", err)
+					return
 				}
+				batchArgs = batchArgs[:0]
+				batchRows = 0
 			}
 		}
 		if seenRows%200 == 0 {
-			fmt.Printf("⏳ 已扫描 channels %d 行\n", seenRows)
+			fmt.Fprintf(console, "⏳ 已扫描 channels %d 行\n", seenRows)
 		}
 	}
 
 	if err := flush(batchArgs, batchRows); err != nil {
 		_ = tx.Rollback()
-		fmt.Printf("⚠️ 重建 abilities 批量写入失败: %v\n", err)
+		fmt.Fprintf(console, "⚠️ 重建 abilities 批量写入失败: %v\n", err)
 		return
 	}
 
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
-		fmt.Printf("⚠️ 提交事务失败（重建 abilities）: %v\n", err)
+		fmt.Fprintf(console, "⚠️ 提交事务失败（重建 abilities）: %v\n", err)
 		return
 	}
 
-	fmt.Printf("✅ abilities 重建完成：扫描 channels=%d，生成写入行=%d（重复键会被忽略）\n", seenRows, inserted)
+	fmt.Fprintf(console, "✅ abilities 重建完成：扫描 channels=%d，生成写入行=%d（重复键按 %s 策略处理）\n", seenRows, inserted, policy)
+}
+
+// channelAbilities 把渠道的 group/models 展开为去重后的 (group, model) 组合
+func channelAbilities(group, models string) [][2]string {
+	groups := dedupStrings(splitCSVTrim(group))
+	modelsList := dedupStrings(splitCSVTrim(models))
+	pairs := make([][2]string, 0, len(groups)*len(modelsList))
+	for _, g := range groups {
+		for _, m := range modelsList {
+			pairs = append(pairs, [2]string{g, m})
+		}
+	}
+	return pairs
 }
 
 func splitCSVTrim(s string) []string {
@@ -237,29 +608,18 @@ func dedupStrings(items []string) []string {
 	return res
 }
 
-func buildBulkInsertSQL(table string, columns []string, driver string, rows int) string {
+func buildBulkInsertSQL(table string, columns []string, driver string, rows int, policy conflictPolicy) string {
 	if rows <= 0 {
 		return ""
 	}
-	quotedCols := make([]string, 0, len(columns))
-	for _, col := range columns {
-		quotedCols = append(quotedCols, quoteIdent(driver, col))
-	}
-
-	valuesPlaceholder := buildValuesPlaceholders(driver, len(columns), rows)
-	tableIdent := quoteIdent(driver, table)
-
 	switch driver {
-	case "mysql":
-		return fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES %s", tableIdent, strings.Join(quotedCols, ","), valuesPlaceholder)
-	case "sqlite":
-		return fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES %s", tableIdent, strings.Join(quotedCols, ","), valuesPlaceholder)
-	case "postgres":
-		return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON CONFLICT DO NOTHING", tableIdent, strings.Join(quotedCols, ","), valuesPlaceholder)
+	case "mysql", "sqlite", "postgres":
 	default:
 		log.Fatalf("不支持的数据库驱动: %s", driver)
 		return ""
 	}
+	valuesPlaceholder := buildValuesPlaceholders(driver, len(columns), rows)
+	return buildInsertStatement(table, columns, driver, valuesPlaceholder, policy)
 }
 
 func buildValuesPlaceholders(driver string, cols int, rows int) string {
@@ -284,18 +644,15 @@ func buildValuesPlaceholders(driver string, cols int, rows int) string {
 	return strings.Join(parts, ",")
 }
 
-func loadConfig() Config {
-	return Config{
-		OldDSN: os.Getenv("ONEAPI_SOURCE_SQL_DSN"),
-		NewDSN: os.Getenv("ONEAPI_TARGET_SQL_DSN"),
-	}
-}
-
 func openDatabase(dsn string) *sql.DB {
 	driver, dsn := detectDriver(dsn)
 	db, err := sql.Open(driver, dsn)
+	if err == nil {
+		err = db.Ping()
+	}
 	if err != nil {
-		log.Fatalf("无法连接到数据库: %v", err)
+		logEvent("connection_failed", eventFields{"driver": driver, "error": err}, "❌ 无法连接到数据库(%s): %v\n", driver, err)
+		os.Exit(exitConnectionFailed)
 	}
 	return db
 }
@@ -372,84 +729,349 @@ func normalizeMySQLURL(dsn string) (string, error) {
 	return dsnCore, nil
 }
 
-func migrateTable(oldDB, newDB *sql.DB, table string) {
+// migrateTables 迁移所有表并按迁移规则的顺序返回每张表的结果。workers 为 1 时逐表迁移；
+// 大于 1 时所有表同时开始，实际的复制由 workers 限制并发
+func migrateTables(oldDB, newDB *sql.DB, cp *checkpoint) []tableSummary {
+	results := make([]tableSummary, len(mapping.Tables))
+	migrate := func(i int) {
+		tm := mapping.Tables[i]
+		table := tm.name()
+		if stopMigration.Load() {
+			results[i] = tableSummary{Table: table, Status: "cancelled"}
+			logEvent("table_cancelled", eventFields{"table": table}, "⏹️ 表 %s 未迁移（--fail-fast）\n", table)
+			return
+		}
+		logEvent("table_start", eventFields{"table": table}, "🚀 正在处理表: %s\n", table)
+		start := time.Now()
+		result, err := migrateTable(oldDB, newDB, tm, cp)
+		result.Table = table
+		result.DurationMS = time.Since(start).Milliseconds()
+		switch {
+		case err != nil && cancelledOnly(err):
+			result.Status = "cancelled"
+			logEvent("table_cancelled", eventFields{"table": table, "stats": result.tableStats, "duration_ms": result.DurationMS},
+				"⏹️ 表 %s 已停止（--fail-fast），已提交 %d 行，断点已保存\n", table, result.Written)
+		case err != nil:
+			result.Status = "failed"
+			result.Error = err.Error()
+			result.Failed = result.Read - result.Written - result.Skipped
+			logEvent("table_failed", eventFields{"table": table, "error": err, "stats": result.tableStats, "duration_ms": result.DurationMS},
+				"⚠️ 表 %s 迁移失败: %v\n", table, err)
+			if config.FailFast {
+				stopMigration.Store(true)
+				fmt.Fprintf(console, "⛔ --fail-fast：表 %s 失败，停止迁移其余表\n", table)
+			}
+		default:
+			logEvent("table_end", eventFields{"table": table, "status": result.Status, "stats": result.tableStats, "duration_ms": result.DurationMS},
+				"✅ 完成处理表: %s\n", table)
+		}
+		results[i] = result
+	}
+
+	if workers.size() <= 1 {
+		for i := range mapping.Tables {
+			migrate(i)
+		}
+		return results
+	}
+
+	fmt.Fprintf(console, "🧵 并发迁移：%d 个 worker\n", workers.size())
+	var wg sync.WaitGroup
+	for i := range mapping.Tables {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			migrate(i)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// resolveTable 读取源表与目标表的列并按迁移规则解析列映射，skip 非空时表示该表应跳过
+func resolveTable(oldDB, newDB *sql.DB, tm TableMapping) (cols resolvedColumns, skip string) {
 	oldDriver, _ := detectDriver(config.OldDSN)
 	newDriver, _ := detectDriver(config.NewDSN)
 
-	oldColumns := getColumns(oldDB, table, oldDriver)
-	newColumns := getColumns(newDB, table, newDriver)
-
+	oldColumns := getColumns(oldDB, tm.Source, oldDriver)
+	newColumns := getColumns(newDB, tm.Target, newDriver)
 	if len(oldColumns) == 0 {
-		fmt.Printf("⚠️ 源库中没有找到表: %s\n", table)
-		return
+		return cols, fmt.Sprintf("源库中没有找到表: %s", tm.Source)
 	}
-
 	if len(newColumns) == 0 {
-		fmt.Printf("⚠️ 新库中没有找到表: %s\n", table)
-		return
+		return cols, fmt.Sprintf("新库中没有找到表: %s", tm.Target)
 	}
 
-	commonColumns := intersectPreserveOrder(newColumns, oldColumns)
-	if len(commonColumns) == 0 {
-		fmt.Printf("⚠️ 表 %s 没有可迁移的同名字段(源/目标列交集为空)，已跳过\n", table)
-		return
+	cols = tm.resolveColumns(oldColumns, newColumns)
+	if len(cols.SourceColumns) == 0 {
+		return cols, fmt.Sprintf("表 %s 没有可迁移的字段(源/目标列交集为空)，已跳过", tm.name())
+	}
+	return cols, ""
+}
+
+// migrateTable 按迁移规则把源库表复制到目标库。
+// 主键为 id 的表按 id 顺序读取、每 ChunkSize 行提交一次并记录断点，重跑时从断点继续；
+// --workers 大于 1 时大表按 id 区间拆分，由多个 goroutine 各自使用独立的事务写入。
+// 其他表仍在单个事务中整体迁移。
+func migrateTable(oldDB, newDB *sql.DB, tm TableMapping, cp *checkpoint) (tableSummary, error) {
+	newDriver, _ := detectDriver(config.NewDSN)
+	table := tm.name()
+
+	state := cp.table(table)
+	if state.Done {
+		logEvent("table_skipped", eventFields{"table": table, "reason": "checkpoint_done", "rows": state.Rows},
+			"⏭️ 表 %s 已在之前的运行中完成（%d 行），跳过；如需重新迁移请使用 --restart\n", table, state.Rows)
+		return tableSummary{Status: "done"}, nil
+	}
+
+	cols, skip := resolveTable(oldDB, newDB, tm)
+	if skip != "" {
+		logEvent("table_skipped", eventFields{"table": table, "reason": skip}, "⚠️ %s\n", skip)
+		return tableSummary{Status: "skipped"}, nil
+	}
+
+	if len(cols.Dropped) > 0 {
+		logEvent("columns_skipped", eventFields{"table": table, "reason": "missing_in_target", "columns": cols.Dropped},
+			"⚠️ 旧库中的表 %s 存在新库中没有的字段: %v\n", tm.Source, cols.Dropped)
+	}
+	if len(cols.Excluded) > 0 {
+		logEvent("columns_skipped", eventFields{"table": table, "reason": "excluded", "columns": cols.Excluded},
+			"ℹ️ 按迁移规则排除表 %s 的字段: %v\n", tm.Source, cols.Excluded)
+	}
+
+	policy := config.Conflict.forTable(tm.Target)
+	if err := checkConflictKeys(tm.Target, policy, cols.targetNames()); err != nil {
+		return tableSummary{}, err
+	}
+	if window := logsWindow(tm); window != "" {
+		fmt.Fprintf(console, "🗓️ 表 %s 只迁移 %s 的行\n", table, window)
+	}
+
+	run := &tableCopy{
+		oldDB:    oldDB,
+		newDB:    newDB,
+		tm:       tm,
+		cols:     cols,
+		cp:       cp,
+		policy:   policy,
+		limits:   detectBatchLimits(newDB, newDriver, config.BatchSize),
+		issues:   &issueLog{},
+		progress: &tableProgress{table: table},
+	}
+	if len(tm.Key) == 1 && tm.Key[0] == "id" {
+		run.idSource = cols.sourceFor("id")
+	}
+	if config.TargetMode == targetAppend && run.idSource != "" && state.Rows == 0 && len(state.Ranges) == 0 {
+		maxID, err := targetMaxID(newDB, tm.Target)
+		if err != nil {
+			return tableSummary{}, fmt.Errorf("查询目标库表 %s 的最大 id 失败: %w", tm.Target, err)
+		}
+		if maxID > 0 {
+			state.LastID = maxID
+			fmt.Fprintf(console, "➕ 表 %s 目标库最大 id 为 %d，只迁移 id > %d 的行\n", table, maxID, maxID)
+		}
 	}
 
-	missingColumns := findMissingColumns(oldColumns, newColumns)
-	if len(missingColumns) > 0 {
-		fmt.Printf("⚠️ 旧库中的表 %s 存在新库中没有的字段: %v\n", table, missingColumns)
+	if logsRollupEnabled(tm) && !state.RolledUp {
+		if err := run.copyRollup(); err != nil {
+			return tableSummary{Status: "ok", tableStats: run.stats()}, err
+		}
 	}
 
-	rows, err := oldDB.Query(fmt.Sprintf("SELECT * FROM %s", quoteIdent(oldDriver, table)))
+	ranges := []idRange{{Index: -1}}
+	if run.idSource != "" {
+		var err error
+		ranges, err = run.planRanges(state)
+		if err != nil {
+			return tableSummary{}, err
+		}
+	}
+	err := workers.run(len(ranges), func(i int) error {
+		err := run.copyRange(ranges[i])
+		if err != nil && !errors.Is(err, errCancelled) && config.FailFast {
+			// 同一张表的其他区间也在下一个 chunk 边界停止
+			stopMigration.Store(true)
+		}
+		return err
+	})
+	result := tableSummary{Status: "ok", tableStats: run.stats()}
 	if err != nil {
-		fmt.Printf("⚠️ 查询源库表 %s 失败: %v\n", table, err)
-		return
+		return result, err
+	}
+
+	fmt.Fprintf(console, "✅ 表 %s 迁移完成，共处理 %d 行数据\n", table, run.count.Load())
+	if result.Skipped > 0 {
+		fmt.Fprintf(console, "⏭️ 表 %s 按规则跳过 %d 行\n", table, result.Skipped)
+	}
+	if !run.issues.empty() {
+		fmt.Fprintf(console, "📋 表 %s 转换汇总（格式不符的值已原样写入）:\n", table)
+		run.issues.print("   ")
+	}
+	return result, nil
+}
+
+// copyRange 复制一个 id 区间（不可续传的表为整张表），使用独立的读取游标与目标库事务
+func (run *tableCopy) copyRange(r idRange) error {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+	tm, cols, cp := run.tm, run.cols, run.cp
+	table := tm.name()
+
+	quotedSource := make([]string, 0, len(cols.SourceColumns))
+	for _, col := range cols.SourceColumns {
+		quotedSource = append(quotedSource, quoteIdent(oldDriver, col))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quotedSource, ","), quoteIdent(oldDriver, tm.Source))
+	var queryArgs []any
+
+	resumable := run.idSource != ""
+	if !resumable {
+		query, queryArgs = withLogsFilter(query, tm, oldDriver)
+	} else {
+		idIdent := quoteIdent(oldDriver, run.idSource)
+		query += fmt.Sprintf(" WHERE %s > %s", idIdent, placeholderAt(oldDriver, 1))
+		queryArgs = append(queryArgs, r.After)
+		if r.To > 0 {
+			query += fmt.Sprintf(" AND %s <= %s", idIdent, placeholderAt(oldDriver, 2))
+			queryArgs = append(queryArgs, r.To)
+		}
+		if filter, args := logsFilter(tm, oldDriver, len(queryArgs)+1); filter != "" {
+			query += " AND " + filter
+			queryArgs = append(queryArgs, args...)
+		}
+		query += " ORDER BY " + idIdent
+	}
+
+	if stopMigration.Load() {
+		return errCancelled
+	}
+	rows, err := run.oldDB.Query(query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("查询源库表 %s 失败: %w", tm.Source, err)
 	}
 	defer rows.Close()
 
-	columns, _ := rows.Columns()
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
+	values := make([]interface{}, len(cols.SourceColumns))
+	valuePtrs := make([]interface{}, len(cols.SourceColumns))
 	for i := range values {
 		valuePtrs[i] = &values[i]
 	}
-	insertSQL := buildInsertSQL(table, commonColumns, newDriver)
+	idIdx := indexOf(cols.SourceColumns, run.idSource)
 
-	tx, err := newDB.Begin()
+	tx, err := run.newDB.Begin()
 	if err != nil {
-		fmt.Printf("⚠️ 开启事务失败: %v\n", err)
-		return
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+
+	batcher := newInsertBatcher(tx, tm.Target, cols.targetNames(), newDriver, run.limits, run.policy)
+
+	// commitChunk 提交当前事务并记录断点，more 为 true 时开启下一个事务
+	lastID := r.After
+	chunkRows := 0
+	commitChunk := func(more bool) error {
+		if err := batcher.flush(); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("插入新库表 %s 失败: %w", tm.Target, err)
+		}
+		if err := tx.Commit(); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("提交事务失败: %w", err)
+		}
+		committed := int64(chunkRows)
+		chunkRows = 0
+		run.written.Add(committed)
+		err := cp.update(table, func(t *tableCheckpoint) {
+			t.Rows += committed
+			if r.Index < 0 {
+				t.LastID = lastID
+				t.Done = !more
+				return
+			}
+			rc := &t.Ranges[r.Index]
+			rc.LastID = lastID
+			rc.Rows += committed
+			rc.Done = !more
+			t.Done = t.rangesDone()
+		})
+		if err != nil {
+			fmt.Fprintf(console, "⚠️ 写入断点文件失败: %v\n", err)
+		}
+		if !more {
+			return nil
+		}
+		if stopMigration.Load() {
+			return errCancelled
+		}
+		tx, err = run.newDB.Begin()
+		if err != nil {
+			return fmt.Errorf("开启事务失败: %w", err)
+		}
+		batcher.tx = tx
+		return nil
+	}
+
+	// rowFailed 回滚当前事务并记录出错时正在处理的行
+	rowFailed := func(err error) error {
+		_ = tx.Rollback()
+		fields := eventFields{"table": table, "error": err}
+		if idIdx >= 0 {
+			fields["id"] = valueString(values[idIdx])
+		}
+		logEvent("row_error", fields, "❌ 表 %s 处理 id=%v 时出错\n", table, fields["id"])
+		return err
 	}
 
-	count := 0
+	reported := 0
 	for rows.Next() {
 		err := rows.Scan(valuePtrs...)
 		if err != nil {
 			_ = tx.Rollback()
-			fmt.Printf("⚠️ 扫描行数据失败: %v\n", err)
-			return
+			return fmt.Errorf("扫描行数据失败: %w", err)
 		}
-		insertValues := buildInsertValues(values, oldColumns, commonColumns, table)
-		_, err = tx.Exec(insertSQL, insertValues...)
-		if err != nil {
-			_ = tx.Rollback()
-			fmt.Printf("⚠️ 插入新库表 %s 失败: %v\n", table, err)
-			return
+		run.read.Add(1)
+		insertValues, err := buildInsertValues(values, cols, tm.Target, convertOptions{Verbose: true, Issues: run.issues})
+		switch {
+		case errors.Is(err, errSkipRow):
+			run.skipped.Add(1)
+		case err != nil:
+			return rowFailed(fmt.Errorf("转换表 %s 的行数据失败: %w", table, err))
+		default:
+			if err := batcher.add(insertValues); err != nil {
+				return rowFailed(fmt.Errorf("插入新库表 %s 失败: %w", tm.Target, err))
+			}
+			run.count.Add(1)
+			chunkRows++
 		}
-		count++
-		if count%100 == 0 {
-			fmt.Printf("⏳ 已处理 %d 行数据\n", count)
+		if batcher.written > reported {
+			run.progress.add(batcher.written - reported)
+			reported = batcher.written
+		}
+		if resumable {
+			id, err := toInt64(values[idIdx])
+			if err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("无法解析表 %s 的 id: %w", table, err)
+			}
+			lastID = id
+			if config.ChunkSize > 0 && chunkRows >= config.ChunkSize {
+				if err := commitChunk(true); err != nil {
+					return err
+				}
+			}
 		}
 	}
-
-	err = tx.Commit()
-	if err != nil {
+	if err := rows.Err(); err != nil {
 		_ = tx.Rollback()
-		fmt.Printf("⚠️ 提交事务失败: %v\n", err)
-		return
+		return fmt.Errorf("读取源库表 %s 失败: %w", tm.Source, err)
 	}
 
-	fmt.Printf("✅ 表 %s 迁移完成，共处理 %d 行数据\n", table, count)
+	if err := commitChunk(false); err != nil {
+		return err
+	}
+	if batcher.written > reported {
+		run.progress.add(batcher.written - reported)
+	}
+	return nil
 }
 
 func getColumns(db *sql.DB, table string, driver string) []string {
@@ -487,26 +1109,16 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
-func buildInsertSQL(table string, columns []string, driver string) string {
-	quotedCols := make([]string, 0, len(columns))
-	for _, col := range columns {
-		quotedCols = append(quotedCols, quoteIdent(driver, col))
-	}
-
-	placeholders := buildPlaceholders(driver, len(columns))
-	tableIdent := quoteIdent(driver, table)
+func buildInsertSQL(table string, columns []string, driver string, policy conflictPolicy) string {
+	return buildBulkInsertSQL(table, columns, driver, 1, policy)
+}
 
-	switch driver {
-	case "mysql":
-		return fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES (%s)", tableIdent, strings.Join(quotedCols, ","), placeholders)
-	case "sqlite":
-		return fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)", tableIdent, strings.Join(quotedCols, ","), placeholders)
-	case "postgres":
-		return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING", tableIdent, strings.Join(quotedCols, ","), placeholders)
-	default:
-		log.Fatalf("不支持的数据库驱动: %s", driver)
-		return ""
+// placeholderAt 返回第 i 个（从 1 开始）参数的占位符
+func placeholderAt(driver string, i int) string {
+	if driver == "postgres" {
+		return "$" + strconv.Itoa(i)
 	}
+	return "?"
 }
 
 func buildPlaceholders(driver string, n int) string {
@@ -533,25 +1145,6 @@ func quoteIdent(driver, ident string) string {
 	}
 }
 
-func buildInsertValues(values []interface{}, oldColumns, commonColumns []string, table string) []interface{} {
-	insertValues := make([]interface{}, 0, len(commonColumns))
-	for _, col := range commonColumns {
-		idx := indexOf(oldColumns, col)
-		if idx == -1 {
-			// 理论上不会发生（commonColumns 是交集），但为健壮性保底
-			insertValues = append(insertValues, getDefaultForType(reflect.TypeOf(values[0])))
-			continue
-		}
-		value := values[idx]
-		if table == "channels" && col == "type" {
-			fmt.Println("🔗 处理渠道类别数据")
-			value = upgradeChannelType(value)
-		}
-		insertValues = append(insertValues, value)
-	}
-	return insertValues
-}
-
 func intersectPreserveOrder(primary, secondary []string) []string {
 	res := make([]string, 0, len(primary))
 	for _, c := range primary {
@@ -571,24 +1164,30 @@ func indexOf(slice []string, item string) int {
 	return -1
 }
 
-func getDefaultForType(t reflect.Type) interface{} {
-	switch t.Kind() {
-	case reflect.String:
-		return ""
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return 0
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return 0
-	case reflect.Float32, reflect.Float64:
-		return 0.0
-	case reflect.Bool:
-		return false
-	case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
-		return nil
+// toInt64 把各驱动扫描出的整数值统一转换为 int64
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case []uint8:
+		return strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64)
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
 	default:
-		return ""
+		return 0, fmt.Errorf("unsupported integer value %T", value)
 	}
 }
+
 func BytesToInt(b []uint8) int {
 	if len(b) < 4 {
 		return 0
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// defaultOptions 是命令行参数的初始值，runCommand 每次执行前恢复
+var defaultOptions = options
+
+// oneHubSchema 是测试用的 one-hub 源库（只保留迁移涉及的列）
+const oneHubSchema = `
+CREATE TABLE channels (id integer primary key autoincrement, type integer default 0, key text, status integer default 1, name text, weight integer, created_time integer, test_time integer, response_time integer, base_url text, other text, balance real, balance_updated_time integer, models text, "group" text, tag text, used_quota integer, model_mapping text, model_headers text, priority integer, proxy text, test_model text, plugin text, only_chat numeric);
+CREATE TABLE users (id integer primary key autoincrement, username text unique, password text, display_name text, role integer, status integer, email text, github_id text, wechat_id text, telegram_id integer, lark_id text, oidc_id text, access_token text, quota integer, used_quota integer, request_count integer, "group" text, aff_code text, aff_count integer, aff_quota integer, aff_history_quota integer, inviter_id integer, last_login_time integer, created_time integer, deleted_at datetime);
+CREATE TABLE tokens (id integer primary key autoincrement, user_id integer, key text unique, status integer, name text, created_time integer, accessed_time integer, expired_time integer, remain_quota integer, unlimited_quota numeric, used_quota integer, chat_cache numeric, "group" text, setting text, backup_group text);
+CREATE TABLE redemptions (id integer primary key autoincrement, user_id integer, key text unique, status integer, name text, quota integer, created_time integer, redeemed_time integer, deleted_at datetime);
+CREATE TABLE options (key text primary key, value text);
+CREATE TABLE logs (id integer primary key autoincrement, user_id integer, created_at integer, type integer, content text, username text, token_name text, token_id integer, model_name text, quota integer, prompt_tokens integer, completion_tokens integer, channel_id integer, request_time integer, is_stream numeric, metadata text);
+INSERT INTO channels VALUES (1,1,'sk-a',1,'openai',0,1700000000,0,0,'https://api.openai.com','',0,0,'gpt-4,gpt-3.5','default','t1',10,'','{"X":"1"}',5,'http://proxy:8080','gpt-4','',0);
+INSERT INTO channels VALUES (2,32,'us-east-1|AKID|SECRET',1,'bedrock',0,1700000000,0,0,'','',0,0,'claude-3','default','',0,'','',0,'','','',0);
+INSERT INTO users VALUES (1,'root','pw','Root',100,1,'root@x.com','','',0,'','','tok1',1000,10,1,'default','a1',0,0,0,0,0,1700000000,NULL);
+INSERT INTO users VALUES (2,'alice','pw','Alice',1,1,'alice@x.com','gh2','',0,'','','tok2',500,5,1,'default','a2',0,0,0,0,0,1700000000,NULL);
+INSERT INTO tokens VALUES (1,1,'k1',1,'root-t',1700000000,0,-1,100,1,0,0,'default','{}','');
+INSERT INTO tokens VALUES (2,2,'k2',1,'alice-t',1700000000,0,-1,100,0,0,0,'default','{}','');
+INSERT INTO redemptions VALUES (1,1,'r1',1,'r',100,1700000000,0,NULL);
+INSERT INTO options VALUES ('SystemName','OneHub'),('RetryTimes','3');
+`
+
+// oneAPISchema 是测试用的 one-api 目标库
+const oneAPISchema = `
+CREATE TABLE channels (id integer primary key autoincrement, type integer default 0, key text, status integer default 1, name text, weight integer default 0, created_time integer, test_time integer, response_time integer, base_url text default '', other text, balance real, balance_updated_time integer, models text, "group" varchar(32) default 'default', used_quota integer default 0, model_mapping varchar(1024) default '', priority integer default 0, config text, system_prompt text);
+CREATE TABLE users (id integer primary key autoincrement, username text unique, password text not null, display_name text, role integer default 1, status integer default 1, email text, github_id text, wechat_id text, lark_id text, oidc_id text, access_token char(32) unique, quota integer default 0, used_quota integer default 0, request_count integer default 0, "group" varchar(32) default 'default', aff_code varchar(32) unique, inviter_id integer);
+CREATE TABLE tokens (id integer primary key autoincrement, user_id integer, key char(48) unique, status integer default 1, name text, created_time integer, accessed_time integer, expired_time integer default -1, remain_quota integer default 0, unlimited_quota numeric default 0, used_quota integer default 0, models text, subnet text default '');
+CREATE TABLE redemptions (id integer primary key autoincrement, user_id integer, key char(32) unique, status integer default 1, name text, quota integer default 100, created_time integer, redeemed_time integer);
+CREATE TABLE options (key text primary key, value text);
+CREATE TABLE logs (id integer primary key autoincrement, user_id integer, created_at integer, type integer, content text, username text default '', token_name text default '', model_name text default '', quota integer default 0, prompt_tokens integer default 0, completion_tokens integer default 0, channel_id integer, request_id text default '', elapsed_time integer default 0, is_stream numeric default 0, system_prompt_reset numeric default 0);
+CREATE TABLE abilities ("group" varchar(32) not null, model text not null, channel_id integer not null, enabled numeric, priority integer default 0, suffix text, primary key("group", model, channel_id));
+`
+
+// fixtureLogs 是源库 logs 表的行数
+const fixtureLogs = 250
+
+// newFixture 在临时目录中创建源库与目标库（SQLite），并把工作目录切换到该目录，
+// 使断点文件、id 对照等默认路径都落在临时目录中
+func newFixture(t *testing.T) (src, dst string) {
+	t.Helper()
+	dir := t.TempDir()
+	src = filepath.Join(dir, "src.db")
+	dst = filepath.Join(dir, "dst.db")
+	execSQL(t, src, oneHubSchema)
+	execSQL(t, dst, oneAPISchema)
+
+	db := openTestDB(t, src)
+	for i := 1; i <= fixtureLogs; i++ {
+		userID := i%2 + 1
+		_, err := db.Exec("INSERT INTO logs VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)",
+			i, userID, 1700000000+i*600, i%3+1, "c", fmt.Sprintf("u%d", userID), "tk", userID, "gpt-4", i, i%50, i%40, 1, 100+i, i%2, `{"a":1}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	return src, dst
+}
+
+func openTestDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func execSQL(t *testing.T, path, script string) {
+	t.Helper()
+	db := openTestDB(t, path)
+	for _, stmt := range strings.Split(script, ";\n") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+}
+
+func countRows(t *testing.T, path, table string) int64 {
+	t.Helper()
+	var n int64
+	if err := openTestDB(t, path).QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// runCommand 在进程内按 main 的流程执行一个子命令并返回退出码，输出写入返回的 buffer。
+// 每次执行前重置全局状态，模拟一次新的进程
+func runCommand(t *testing.T, args ...string) (int, *bytes.Buffer) {
+	t.Helper()
+	var out bytes.Buffer
+	config = Config{}
+	options = defaultOptions
+	mapping = defaultMapping()
+	ids = nil
+	userCollisions = nil
+	events = &eventLog{format: logFormatText, out: &out}
+	console = &out
+	stopMigration.Store(false)
+	workers = newWorkerPool(1)
+
+	cmd, rest := parseCommand(args)
+	config.ChannelTypes = make(channelTypeFlag)
+	fs := newFlagSet(cmd)
+	fs.SetOutput(&out)
+	if err := fs.Parse(rest); err != nil {
+		t.Fatalf("解析参数 %v 失败: %v", args, err)
+	}
+	if err := setupConfig(); err != nil {
+		t.Fatalf("setupConfig: %v", err)
+	}
+	if err := setupEvents(config.LogFormat); err != nil {
+		t.Fatalf("setupEvents: %v", err)
+	}
+	console = &out
+	if err := applyChannelTypeOverrides(mapping.channelTypeOverrides()); err != nil {
+		t.Fatalf("applyChannelTypeOverrides: %v", err)
+	}
+	if err := resolveDSNs(cmd, fs.Args()); err != nil {
+		t.Fatalf("resolveDSNs: %v", err)
+	}
+	return cmd.run(), &out
+}
+
+func TestPlanDoesNotWrite(t *testing.T) {
+	src, dst := newFixture(t)
+	code, out := runCommand(t, "plan", src, dst)
+	if code != exitOK {
+		t.Fatalf("plan 退出码 = %d，输出:\n%s", code, out)
+	}
+	for _, table := range []string{"channels", "users", "tokens", "redemptions", "options", "logs", "abilities"} {
+		if n := countRows(t, dst, table); n != 0 {
+			t.Errorf("plan 后目标库表 %s 有 %d 行，应为 0", table, n)
+		}
+	}
+	if !strings.Contains(out.String(), "未写入任何数据") {
+		t.Errorf("plan 输出缺少未写入的提示:\n%s", out)
+	}
+	if !strings.Contains(out.String(), "未检查目标库账号对") {
+		t.Errorf("plan 的预检不应对目标库执行 INSERT，输出应提示未检查写入权限:\n%s", out)
+	}
+	if _, err := os.Stat(defaultCheckpointFile); !os.IsNotExist(err) {
+		t.Errorf("plan 不应创建断点文件: %v", err)
+	}
+}
+
+// 一张表失败后重新运行时，已完成的表按断点跳过、不会重复写入，修复后的表补齐，最终校验通过
+func TestMigrateResumeAndVerify(t *testing.T) {
+	src, dst := newFixture(t)
+	execSQL(t, dst, `DROP TABLE tokens;
+CREATE TABLE tokens (id integer primary key autoincrement, user_id integer, key char(48) unique, status integer default 1, name text, created_time integer, accessed_time integer, expired_time integer default -1, remain_quota integer default 0, unlimited_quota numeric default 0, used_quota integer default 0, models text, subnet text default '', owner text not null);
+`)
+
+	// SQLite 的 INSERT OR IGNORE 会跳过违反 NOT NULL 的行，tokens 按 error 策略写入才会失败
+	code, out := runCommand(t, "migrate", "--conflict", "ignore,tokens=error", src, dst)
+	if code != exitTablesFailed {
+		t.Fatalf("第一次 migrate 退出码 = %d，应为 %d，输出:\n%s", code, exitTablesFailed, out)
+	}
+	if _, err := os.Stat(defaultCheckpointFile); err != nil {
+		t.Fatalf("失败后应保留断点文件: %v", err)
+	}
+	if n := countRows(t, dst, "logs"); n != fixtureLogs {
+		t.Fatalf("第一次 migrate 后 logs 有 %d 行，应为 %d", n, fixtureLogs)
+	}
+
+	execSQL(t, dst, `DROP TABLE tokens;
+CREATE TABLE tokens (id integer primary key autoincrement, user_id integer, key char(48) unique, status integer default 1, name text, created_time integer, accessed_time integer, expired_time integer default -1, remain_quota integer default 0, unlimited_quota numeric default 0, used_quota integer default 0, models text, subnet text default '');
+`)
+	code, out = runCommand(t, "migrate", "--conflict", "ignore,tokens=error", "--verify", src, dst)
+	if code != exitOK {
+		t.Fatalf("重新运行 migrate 退出码 = %d，输出:\n%s", code, out)
+	}
+	if !strings.Contains(out.String(), "表 logs 已在之前的运行中完成") {
+		t.Errorf("重新运行时应跳过已完成的 logs 表，输出:\n%s", out)
+	}
+	for table, want := range map[string]int64{"users": 2, "channels": 2, "tokens": 2, "redemptions": 1, "logs": fixtureLogs} {
+		if n := countRows(t, dst, table); n != want {
+			t.Errorf("目标库表 %s 有 %d 行，应为 %d", table, n, want)
+		}
+	}
+
+	if code, out := runCommand(t, "verify", src, dst); code != exitOK {
+		t.Errorf("verify 退出码 = %d，输出:\n%s", code, out)
+	}
+}
+
+// 目标库缺表时无法校验该表，校验应判为未通过而不是跳过
+func TestVerifyFailsWhenTargetTableMissing(t *testing.T) {
+	src, dst := newFixture(t)
+	if code, out := runCommand(t, "migrate", src, dst); code != exitOK {
+		t.Fatalf("migrate 退出码 = %d，输出:\n%s", code, out)
+	}
+	execSQL(t, dst, "DROP TABLE tokens")
+
+	code, out := runCommand(t, "verify", src, dst)
+	if code != exitVerifyFailed {
+		t.Fatalf("verify 退出码 = %d，应为 %d，输出:\n%s", code, exitVerifyFailed, out)
+	}
+	if !strings.Contains(out.String(), "表 tokens 无法校验") {
+		t.Errorf("输出缺少 tokens 无法校验的报告:\n%s", out)
+	}
+	if strings.Contains(out.String(), "校验通过") {
+		t.Errorf("目标库缺表时不应报告校验通过:\n%s", out)
+	}
+}
+
+// 按兜底策略禁用的 Bedrock 渠道保留原密钥，不把密钥中的字段写入 config
+func TestMigrateDisabledChannelKeepsKey(t *testing.T) {
+	src, dst := newFixture(t)
+	if code, out := runCommand(t, "migrate", "--channel-fallback", "disable,32=disable", src, dst); code != exitOK {
+		t.Fatalf("migrate 退出码 = %d，输出:\n%s", code, out)
+	}
+	var key, name string
+	var status int
+	var cfg sql.NullString
+	if err := openTestDB(t, dst).QueryRow("SELECT key, name, status, config FROM channels WHERE id = 2").Scan(&key, &name, &status, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if key != "us-east-1|AKID|SECRET" {
+		t.Errorf("禁用渠道的密钥 = %q，应保留原密钥", key)
+	}
+	if status != TargetChannelStatusManuallyDisabled || !strings.HasPrefix(name, "[one-hub 类型 32]") {
+		t.Errorf("渠道应被禁用并标记: status=%d name=%q", status, name)
+	}
+	if strings.Contains(cfg.String, "AKID") {
+		t.Errorf("禁用渠道的 config 不应包含密钥字段: %s", cfg.String)
+	}
+}
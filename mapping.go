@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Mapping 描述源库到目标库要迁移哪些表，以及列如何对应、如何转换
+type Mapping struct {
+	Tables []TableMapping `json:"tables"`
+	// ChannelTypes 扩展或覆盖内置的渠道类型映射：one-hub 类型 -> one-api 类型
+	ChannelTypes map[string]int `json:"channel_types,omitempty"`
+	// OptionKeys 扩展或覆盖内置的配置项转换表：one-hub 配置项 -> one-api 配置项，为空字符串时不迁移
+	OptionKeys map[string]string `json:"option_keys,omitempty"`
+}
+
+// TableMapping 是一张源表到一张目标表的迁移规则。
+// 目标表中与源表同名（或经 Rename 改名后同名）的列会被复制，Exclude 中的源列不复制，
+// Defaults 为没有来源的目标列提供常量值，Fold 把若干源列合并进目标列的 JSON 对象，
+// Transforms 对目标列的值应用命名转换。
+type TableMapping struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Key 是目标表的主键列，用于断点续传、upsert 与校验
+	Key []string `json:"key,omitempty"`
+	// Rename 把源列名映射为目标列名
+	Rename map[string]string `json:"rename,omitempty"`
+	// Defaults 为目标库独有的列提供常量值
+	Defaults map[string]any `json:"defaults,omitempty"`
+	// Exclude 中的源列不会迁移
+	Exclude []string `json:"exclude,omitempty"`
+	// Fold 把源列写入目标列 JSON 对象的字段：目标列 -> JSON 字段名 -> 源列
+	Fold map[string]map[string]string `json:"fold,omitempty"`
+	// Transforms 把目标列映射到 transforms 中注册的转换名
+	Transforms map[string]string `json:"transforms,omitempty"`
+	// MergeIDs 为 true 时合并模式（--merge）下为该表的行分配新 id
+	MergeIDs bool `json:"merge_ids,omitempty"`
+	// References 是引用其他表 id 的列：目标列 -> 被引用的目标表，合并模式下随之改写
+	References map[string]string `json:"references,omitempty"`
+}
+
+// mapping 是当前生效的迁移规则，默认为 defaultMapping，可由 --mapping 指定的文件替换
+var mapping = defaultMapping()
+
+// defaultMapping 是内置的 one-hub -> one-api 迁移规则
+func defaultMapping() Mapping {
+	return Mapping{Tables: []TableMapping{
+		{
+			Source: "channels",
+			Target: "channels",
+			Key:    []string{"id"},
+			// one-hub 独有的渠道设置保存到 one-api 的 config JSON 中，避免丢失
+			Fold: map[string]map[string]string{
+				"config": {"proxy": "proxy", "model_headers": "model_headers", "test_model": "test_model"},
+			},
+			Exclude: []string{"tag", "only_chat", "plugin", "pre_cost", "compatible_response", "disabled_stream"},
+			// 多段密钥按 one-api 的格式重排，其中的字段同时写入 config；
+			// 没有对应类型的渠道按 --channel-fallback 处理，被禁用的渠道同时修改 status 和 name
+			Transforms: map[string]string{
+				"type":   "channel_type",
+				"key":    "channel_key",
+				"config": "channel_config",
+				"status": "channel_status",
+				"name":   "channel_name",
+			},
+			MergeIDs: true,
+		},
+		{
+			Source: "logs",
+			Target: "logs",
+			Key:    []string{"id"},
+			// one-hub 的 request_time 与 one-api 的 elapsed_time 都以毫秒计；metadata 附加到 content
+			Rename:     map[string]string{"request_time": "elapsed_time"},
+			Transforms: map[string]string{"is_stream": "log_stream", "content": "log_content"},
+			MergeIDs:   true,
+			References: map[string]string{"user_id": "users", "channel_id": "channels"},
+		},
+		{
+			Source: "options",
+			Target: "options",
+			Key:    []string{"key"},
+			// 配置项按转换表改名、转换值，one-api 中没有对应功能的配置项不迁移
+			Transforms: map[string]string{"key": "option_key", "value": "option_value"},
+		},
+		{
+			Source:     "redemptions",
+			Target:     "redemptions",
+			Key:        []string{"id"},
+			Exclude:    []string{"deleted_at"},
+			MergeIDs:   true,
+			References: map[string]string{"user_id": "users"},
+		},
+		{
+			Source: "tokens",
+			Target: "tokens",
+			Key:    []string{"id"},
+			// one-hub 把模型/IP 限制保存在 setting JSON 中，one-api 使用 models/subnet 列
+			Exclude:    []string{"chat_cache", "group", "backup_group"},
+			Transforms: map[string]string{"models": "token_models", "subnet": "token_subnet"},
+			MergeIDs:   true,
+			References: map[string]string{"user_id": "users"},
+		},
+		{
+			Source: "users",
+			Target: "users",
+			Key:    []string{"id"},
+			Exclude: []string{
+				"avatar_url", "telegram_id", "aff_count", "aff_quota", "aff_history_quota",
+				"last_login_time", "last_login_ip", "created_time", "deleted_at",
+			},
+			// 与目标库已有用户冲突的用户按 --user-collision 处理
+			Transforms: map[string]string{
+				"username":     "user_unique",
+				"email":        "user_unique",
+				"github_id":    "user_unique",
+				"access_token": "user_unique",
+			},
+			MergeIDs:   true,
+			References: map[string]string{"inviter_id": "users"},
+		},
+		{
+			Source:     "abilities",
+			Target:     "abilities",
+			Key:        []string{"group", "model", "channel_id"},
+			References: map[string]string{"channel_id": "channels"},
+		},
+	}}
+}
+
+// loadMapping 读取 JSON 或 YAML（扩展名为 .yaml/.yml）格式的迁移规则文件，path 为空时返回内置规则
+func loadMapping(path string) (Mapping, error) {
+	if path == "" {
+		return defaultMapping(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("读取迁移规则文件失败: %w", err)
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return Mapping{}, fmt.Errorf("解析迁移规则文件 %s 失败: %w", path, err)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	var m Mapping
+	if err := dec.Decode(&m); err != nil {
+		return Mapping{}, fmt.Errorf("解析迁移规则文件 %s 失败: %w", path, err)
+	}
+	for i := range m.Tables {
+		t := &m.Tables[i]
+		if t.Source == "" {
+			t.Source = t.Target
+		}
+		if t.Target == "" {
+			t.Target = t.Source
+		}
+		for col, v := range t.Defaults {
+			t.Defaults[col] = jsonScalar(v)
+		}
+	}
+	if err := m.validate(); err != nil {
+		return Mapping{}, fmt.Errorf("迁移规则文件 %s 无效: %w", path, err)
+	}
+	return m, nil
+}
+
+// yamlToJSON 把 YAML 格式的迁移规则转换为 JSON，之后与 JSON 文件走同样的解析与校验
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(yamlStringKeys(doc))
+}
+
+// yamlStringKeys 把 YAML 中非字符串的键（如 channel_types 的 32: 33）转换为字符串，与 JSON 的写法一致
+func yamlStringKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = yamlStringKeys(item)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = yamlStringKeys(item)
+		}
+		return m
+	case []any:
+		for i, item := range v {
+			v[i] = yamlStringKeys(item)
+		}
+		return v
+	}
+	return v
+}
+
+// jsonScalar 把 json.Number 转换为 int64 或 float64，便于作为 SQL 参数
+func jsonScalar(v any) any {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
+func (m Mapping) validate() error {
+	if len(m.Tables) == 0 {
+		return fmt.Errorf("没有配置任何表")
+	}
+	for src := range m.ChannelTypes {
+		if _, err := strconv.Atoi(strings.TrimSpace(src)); err != nil {
+			return fmt.Errorf("channel_types 中的源类型 %q 不是整数", src)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, t := range m.Tables {
+		if t.Target == "" {
+			return fmt.Errorf("存在未指定 source/target 的表")
+		}
+		if seen[t.name()] {
+			return fmt.Errorf("表 %s 重复配置", t.name())
+		}
+		seen[t.name()] = true
+		for col, name := range t.Transforms {
+			if _, ok := transforms[name]; !ok {
+				return fmt.Errorf("表 %s 的列 %s 使用了未知的转换 %q（可选: %s）", t.name(), col, name, strings.Join(transformNames(), ", "))
+			}
+		}
+		for col, fields := range t.Fold {
+			if len(fields) == 0 {
+				return fmt.Errorf("表 %s 的 fold 列 %s 没有配置字段", t.name(), col)
+			}
+		}
+		if t.MergeIDs && !(len(t.Key) == 1 && t.Key[0] == "id") {
+			return fmt.Errorf("表 %s 的主键不是 id，不能使用 merge_ids", t.name())
+		}
+		for col, ref := range t.References {
+			if !m.hasMergeIDs(ref) {
+				return fmt.Errorf("表 %s 的列 %s 引用的表 %s 没有配置 merge_ids", t.name(), col, ref)
+			}
+		}
+		renamed := make(map[string]string)
+		for src, dst := range t.Rename {
+			if prev, ok := renamed[dst]; ok {
+				return fmt.Errorf("表 %s 的源列 %s 和 %s 都改名为 %s", t.name(), prev, src, dst)
+			}
+			renamed[dst] = src
+		}
+	}
+	return nil
+}
+
+// hasMergeIDs 表示目标表 target 在合并模式下分配新 id
+func (m Mapping) hasMergeIDs(target string) bool {
+	for _, t := range m.Tables {
+		if t.Target == target && t.MergeIDs {
+			return true
+		}
+	}
+	return false
+}
+
+// selectTables 只保留 names 中列出的表（按 name()、源表名或目标表名匹配），names 为空时保留全部
+func (m *Mapping) selectTables(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	var selected []TableMapping
+	for _, name := range names {
+		found := false
+		for _, t := range m.Tables {
+			if name == t.name() || name == t.Source || name == t.Target {
+				selected = append(selected, t)
+				found = true
+				break
+			}
+		}
+		if !found {
+			known := make([]string, 0, len(m.Tables))
+			for _, t := range m.Tables {
+				known = append(known, t.name())
+			}
+			return fmt.Errorf("迁移规则中没有表 %s（可选: %s）", name, strings.Join(known, ", "))
+		}
+	}
+	m.Tables = selected
+	return nil
+}
+
+// excludeTarget 去掉写入目标表 target 的规则，剩余没有表时返回错误
+func (m *Mapping) excludeTarget(target string) error {
+	kept := m.Tables[:0]
+	for _, t := range m.Tables {
+		if t.Target != target {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == 0 {
+		return fmt.Errorf("排除表 %s 后没有要迁移的表", target)
+	}
+	m.Tables = kept
+	return nil
+}
+
+// channelTypeOverrides 返回规则文件中的渠道类型映射
+func (m Mapping) channelTypeOverrides() map[int]int {
+	overrides := make(map[int]int, len(m.ChannelTypes))
+	for src, dst := range m.ChannelTypes {
+		if t, err := strconv.Atoi(strings.TrimSpace(src)); err == nil {
+			overrides[t] = dst
+		}
+	}
+	return overrides
+}
+
+// name 是表在日志与断点中的名字
+func (t TableMapping) name() string {
+	if t.Source == t.Target {
+		return t.Target
+	}
+	return t.Source + "->" + t.Target
+}
+
+// tableFor 返回写入目标表 target 的迁移规则
+func (m Mapping) tableFor(target string) (TableMapping, bool) {
+	for _, t := range m.Tables {
+		if t.Target == target {
+			return t, true
+		}
+	}
+	return TableMapping{}, false
+}
+
+// sourceColumnFor 返回写入目标列 target 的源列名（考虑 Rename）
+func (t TableMapping) sourceColumnFor(target string) string {
+	for src, dst := range t.Rename {
+		if dst == target {
+			return src
+		}
+	}
+	return target
+}
+
+// targetKeys 返回目标表的主键列
+func (m Mapping) targetKeys(target string) []string {
+	for _, t := range m.Tables {
+		if t.Target == target && len(t.Key) > 0 {
+			return t.Key
+		}
+	}
+	return nil
+}
+
+// columnMapping 是一个目标列的数据来源
+type columnMapping struct {
+	Target string
+	// Source 为空时使用常量 Default
+	Source  string
+	Default any
+	// Fold 是合并进该列 JSON 对象的字段：JSON 字段名 -> 源列
+	Fold      map[string]string
+	Transform string
+}
+
+// resolvedColumns 是按源表/目标表实际列解析出的列映射
+type resolvedColumns struct {
+	Columns []columnMapping
+	// SourceColumns 是需要从源表读取的列（去重，保持目标列顺序）
+	SourceColumns []string
+	// Dropped 是源表中没有对应目标列的列，Excluded 是按配置排除的列
+	Dropped  []string
+	Excluded []string
+	// Folded 记录合并进目标列 JSON 的源列（源列 -> 目标列.字段）
+	Folded map[string]string
+	// TargetOnly 是没有来源、使用目标库默认值的列
+	TargetOnly []string
+}
+
+// targetNames 返回写入的目标列名
+func (r resolvedColumns) targetNames() []string {
+	names := make([]string, 0, len(r.Columns))
+	for _, c := range r.Columns {
+		names = append(names, c.Target)
+	}
+	return names
+}
+
+// sourceFor 返回目标列对应的源列名
+func (r resolvedColumns) sourceFor(target string) string {
+	for _, c := range r.Columns {
+		if c.Target == target {
+			return c.Source
+		}
+	}
+	return ""
+}
+
+// resolveColumns 按目标表列顺序确定每个目标列的来源
+func (t TableMapping) resolveColumns(oldColumns, newColumns []string) resolvedColumns {
+	res := resolvedColumns{Folded: make(map[string]string)}
+
+	// 合并进 JSON 的源列：源列 -> 目标列
+	folded := make(map[string]string)
+	for target, fields := range t.Fold {
+		if !contains(newColumns, target) {
+			continue
+		}
+		for field, src := range fields {
+			if contains(oldColumns, src) {
+				folded[src] = target
+				res.Folded[src] = target + "." + field
+			}
+		}
+	}
+
+	// 被转换函数读取的源列
+	consumed := make(map[string]bool)
+	for target, name := range t.Transforms {
+		if !contains(newColumns, target) {
+			continue
+		}
+		for _, input := range transforms[name].Inputs {
+			consumed[input] = true
+		}
+	}
+
+	// 目标列名 -> 源列名
+	sources := make(map[string]string)
+	for _, col := range oldColumns {
+		if contains(t.Exclude, col) {
+			res.Excluded = append(res.Excluded, col)
+			continue
+		}
+		target := col
+		if renamed, ok := t.Rename[col]; ok {
+			target = renamed
+		}
+		if !contains(newColumns, target) {
+			if _, ok := folded[col]; !ok && !consumed[col] {
+				res.Dropped = append(res.Dropped, col)
+			}
+			continue
+		}
+		// 改名优先于同名列
+		if _, taken := sources[target]; taken && target == col {
+			res.Dropped = append(res.Dropped, col)
+			continue
+		}
+		if prev, taken := sources[target]; taken {
+			res.Dropped = append(res.Dropped, prev)
+		}
+		sources[target] = col
+	}
+
+	addSource := func(src string) {
+		if !contains(res.SourceColumns, src) {
+			res.SourceColumns = append(res.SourceColumns, src)
+		}
+	}
+	for _, col := range newColumns {
+		c := columnMapping{Target: col, Transform: t.Transforms[col]}
+		src, hasSource := sources[col]
+		def, hasDefault := t.Defaults[col]
+		switch {
+		case hasSource:
+			c.Source = src
+			addSource(src)
+		case hasDefault:
+			c.Default = def
+		}
+		for field, src := range t.Fold[col] {
+			if folded[src] != col {
+				continue
+			}
+			if c.Fold == nil {
+				c.Fold = make(map[string]string)
+			}
+			c.Fold[field] = src
+			addSource(src)
+		}
+		hasInput := false
+		if c.Transform != "" {
+			for _, input := range transforms[c.Transform].Inputs {
+				if contains(oldColumns, input) {
+					addSource(input)
+					hasInput = true
+				}
+			}
+		}
+		if !hasSource && !hasDefault && c.Fold == nil && !hasInput {
+			res.TargetOnly = append(res.TargetOnly, col)
+			continue
+		}
+		res.Columns = append(res.Columns, c)
+	}
+	return res
+}
+
+// printMapping 以 JSON 格式输出迁移规则，可作为 --mapping 文件的模板
+func printMapping(m Mapping) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(console, string(data))
+	return nil
+}
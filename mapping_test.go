@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveColumns(t *testing.T) {
+	tests := []struct {
+		name        string
+		table       TableMapping
+		old, new    []string
+		want        []columnMapping
+		wantSources []string
+		dropped     []string
+		excluded    []string
+		folded      map[string]string
+		targetOnly  []string
+	}{
+		{
+			name:        "同名列按目标表顺序",
+			table:       TableMapping{Source: "t", Target: "t"},
+			old:         []string{"name", "id"},
+			new:         []string{"id", "name"},
+			want:        []columnMapping{{Target: "id", Source: "id"}, {Target: "name", Source: "name"}},
+			wantSources: []string{"id", "name"},
+		},
+		{
+			name:        "改名",
+			table:       TableMapping{Source: "logs", Target: "logs", Rename: map[string]string{"request_time": "elapsed_time"}},
+			old:         []string{"id", "request_time"},
+			new:         []string{"id", "elapsed_time"},
+			want:        []columnMapping{{Target: "id", Source: "id"}, {Target: "elapsed_time", Source: "request_time"}},
+			wantSources: []string{"id", "request_time"},
+		},
+		{
+			name:        "改名优先于同名列",
+			table:       TableMapping{Source: "t", Target: "t", Rename: map[string]string{"nick": "name"}},
+			old:         []string{"id", "name", "nick"},
+			new:         []string{"id", "name"},
+			want:        []columnMapping{{Target: "id", Source: "id"}, {Target: "name", Source: "nick"}},
+			wantSources: []string{"id", "nick"},
+			dropped:     []string{"name"},
+		},
+		{
+			name:        "排除、丢弃与目标独有列",
+			table:       TableMapping{Source: "t", Target: "t", Exclude: []string{"tag"}},
+			old:         []string{"id", "tag", "plugin"},
+			new:         []string{"id", "config"},
+			want:        []columnMapping{{Target: "id", Source: "id"}},
+			wantSources: []string{"id"},
+			dropped:     []string{"plugin"},
+			excluded:    []string{"tag"},
+			targetOnly:  []string{"config"},
+		},
+		{
+			name:        "常量默认值",
+			table:       TableMapping{Source: "t", Target: "t", Defaults: map[string]any{"system_prompt": ""}},
+			old:         []string{"id"},
+			new:         []string{"id", "system_prompt"},
+			want:        []columnMapping{{Target: "id", Source: "id"}, {Target: "system_prompt", Default: ""}},
+			wantSources: []string{"id"},
+		},
+		{
+			name: "合并进 JSON 列",
+			table: TableMapping{Source: "channels", Target: "channels",
+				Fold: map[string]map[string]string{"config": {"proxy": "proxy", "test_model": "test_model"}}},
+			old:         []string{"id", "proxy", "test_model"},
+			new:         []string{"id", "config"},
+			want:        []columnMapping{{Target: "id", Source: "id"}, {Target: "config", Fold: map[string]string{"proxy": "proxy", "test_model": "test_model"}}},
+			wantSources: []string{"id", "proxy", "test_model"},
+			folded:      map[string]string{"proxy": "config.proxy", "test_model": "config.test_model"},
+		},
+		{
+			name:        "转换函数读取的源列不算丢弃",
+			table:       TableMapping{Source: "logs", Target: "logs", Transforms: map[string]string{"content": "log_content"}},
+			old:         []string{"id", "content", "metadata"},
+			new:         []string{"id", "content"},
+			want:        []columnMapping{{Target: "id", Source: "id"}, {Target: "content", Source: "content", Transform: "log_content"}},
+			wantSources: []string{"id", "content", "metadata"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.table.resolveColumns(tt.old, tt.new)
+			if !reflect.DeepEqual(got.Columns, tt.want) {
+				t.Errorf("Columns = %+v\nwant %+v", got.Columns, tt.want)
+			}
+			if !reflect.DeepEqual(got.SourceColumns, tt.wantSources) {
+				t.Errorf("SourceColumns = %v, want %v", got.SourceColumns, tt.wantSources)
+			}
+			if !reflect.DeepEqual(got.Dropped, tt.dropped) {
+				t.Errorf("Dropped = %v, want %v", got.Dropped, tt.dropped)
+			}
+			if !reflect.DeepEqual(got.Excluded, tt.excluded) {
+				t.Errorf("Excluded = %v, want %v", got.Excluded, tt.excluded)
+			}
+			if tt.folded == nil {
+				tt.folded = map[string]string{}
+			}
+			if !reflect.DeepEqual(got.Folded, tt.folded) {
+				t.Errorf("Folded = %v, want %v", got.Folded, tt.folded)
+			}
+			if !reflect.DeepEqual(got.TargetOnly, tt.targetOnly) {
+				t.Errorf("TargetOnly = %v, want %v", got.TargetOnly, tt.targetOnly)
+			}
+		})
+	}
+}
+
+func TestLoadMappingYAML(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "mapping.yaml")
+	yamlRules := `
+channel_types:
+  32: 33
+tables:
+  - source: logs
+    key: [id]
+    rename:
+      request_time: elapsed_time
+    defaults:
+      system_prompt_reset: 0
+`
+	if err := os.WriteFile(yamlPath, []byte(yamlRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jsonPath := filepath.Join(dir, "mapping.json")
+	jsonRules := `{"channel_types": {"32": 33}, "tables": [{"source": "logs", "key": ["id"],
+		"rename": {"request_time": "elapsed_time"}, "defaults": {"system_prompt_reset": 0}}]}`
+	if err := os.WriteFile(jsonPath, []byte(jsonRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fromYAML, err := loadMapping(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := loadMapping(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Errorf("YAML 与 JSON 规则解析结果不同:\nyaml %+v\njson %+v", fromYAML, fromJSON)
+	}
+	if got := fromYAML.Tables[0].Target; got != "logs" {
+		t.Errorf("target 应默认为 source，实际为 %q", got)
+	}
+
+	bad := filepath.Join(dir, "bad.yml")
+	if err := os.WriteFile(bad, []byte("tables:\n  - sourc: logs\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadMapping(bad); err == nil {
+		t.Error("未知字段应返回错误")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultIDMapFile 是合并模式导出新旧 id 对照的默认路径
+const defaultIDMapFile = "db-transfer-id-map.csv"
+
+// idRemap 是合并模式（--merge）下的 id 改写规则：带 merge_ids 的表的 id 加上该表的偏移量，
+// references 中的列随被引用表的偏移量改写。偏移量默认为迁移开始前目标库表的最大 id
+type idRemap struct {
+	// Offsets 是目标表 -> id 偏移量
+	Offsets map[string]int64
+	// Overrides 是单独指定目标库 id 的行：目标表 -> 源库 id -> 目标库 id，优先于偏移量，
+	// 用于归入目标库已有用户的冲突用户（见 --user-collision）
+	Overrides map[string]map[int64]int64
+	// columns 是目标表 -> 列 -> 按哪张目标表的偏移量改写（id 列为表自身）
+	columns map[string]map[string]string
+}
+
+// ids 是当前生效的 id 改写规则，不是合并模式且没有归入已有用户的冲突用户时为 nil
+var ids *idRemap
+
+func newIDRemap(offsets map[string]int64) *idRemap {
+	r := &idRemap{Offsets: offsets, columns: make(map[string]map[string]string)}
+	add := func(table, column, ref string) {
+		if r.columns[table] == nil {
+			r.columns[table] = make(map[string]string)
+		}
+		r.columns[table][column] = ref
+	}
+	for _, tm := range mapping.Tables {
+		if tm.MergeIDs {
+			add(tm.Target, "id", tm.Target)
+		}
+		for column, ref := range tm.References {
+			add(tm.Target, column, ref)
+		}
+	}
+	return r
+}
+
+// setOverride 指定源库 id 在目标表中对应的 id
+func (r *idRemap) setOverride(table string, oldID, newID int64) {
+	if r.Overrides == nil {
+		r.Overrides = make(map[string]map[int64]int64)
+	}
+	if r.Overrides[table] == nil {
+		r.Overrides[table] = make(map[int64]int64)
+	}
+	r.Overrides[table][oldID] = newID
+}
+
+// rewrite 返回目标表列改写后的值；0 与 NULL 表示没有引用，保持不变
+func (r *idRemap) rewrite(table, column string, value any) (any, error) {
+	ref, ok := r.columns[table][column]
+	if !ok || value == nil {
+		return value, nil
+	}
+	offset := r.Offsets[ref]
+	if offset == 0 && len(r.Overrides[ref]) == 0 {
+		return value, nil
+	}
+	id, err := toInt64(value)
+	if err != nil {
+		return nil, fmt.Errorf("无法改写 id: %w", err)
+	}
+	if id <= 0 {
+		return value, nil
+	}
+	if newID, ok := r.Overrides[ref][id]; ok {
+		return newID, nil
+	}
+	if offset == 0 {
+		return value, nil
+	}
+	return id + offset, nil
+}
+
+// parseIDOffsets 解析形如 "users=10000,channels=500" 的偏移量
+func parseIDOffsets(s string) (map[string]int64, error) {
+	offsets := make(map[string]int64)
+	for _, item := range splitCSVTrim(s) {
+		table, value, ok := strings.Cut(item, "=")
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("无效的 id 偏移量 %q（格式 表=非负整数）", item)
+		}
+		offsets[strings.TrimSpace(table)] = n
+	}
+	return offsets, nil
+}
+
+// checkMergeReferences 确认合并模式下被引用的表也在本次迁移中，否则引用列无法改写
+func checkMergeReferences() error {
+	remapped := make(map[string]bool)
+	for _, tm := range mapping.Tables {
+		if tm.MergeIDs {
+			remapped[tm.Target] = true
+		}
+	}
+	for _, tm := range mapping.Tables {
+		for column, ref := range tm.References {
+			if !remapped[ref] {
+				return fmt.Errorf("合并模式下表 %s 的 %s 引用了表 %s，需要同时迁移 %s", tm.name(), column, ref, ref)
+			}
+		}
+	}
+	return nil
+}
+
+// setupMerge 确定合并模式的 id 偏移量：续传时沿用断点中的偏移量；否则取目标库表当前的最大 id，
+// --id-offset 指定的偏移量不能小于该值。persist 为 true 时把偏移量写入断点
+func setupMerge(newDB *sql.DB, cp *checkpoint, overrides map[string]int64, persist bool) (*idRemap, error) {
+	if err := checkMergeReferences(); err != nil {
+		return nil, err
+	}
+	if cp != nil && len(cp.IDOffsets) > 0 {
+		fmt.Fprintln(console, "🔀 合并模式：沿用断点中的 id 偏移量")
+		r := newIDRemap(cp.IDOffsets)
+		r.print()
+		return r, nil
+	}
+
+	newDriver, _ := detectDriver(config.NewDSN)
+	offsets := make(map[string]int64)
+	for _, tm := range mapping.Tables {
+		if !tm.MergeIDs {
+			continue
+		}
+		var maxID int64
+		if ok, err := tableExists(newDB, newDriver, tm.Target); err != nil {
+			return nil, fmt.Errorf("检查目标库表 %s 失败: %w", tm.Target, err)
+		} else if ok {
+			if maxID, err = targetMaxID(newDB, tm.Target); err != nil {
+				return nil, fmt.Errorf("查询目标库表 %s 的最大 id 失败: %w", tm.Target, err)
+			}
+		}
+		offsets[tm.Target] = maxID
+		if n, ok := overrides[tm.Target]; ok {
+			if n < maxID {
+				return nil, fmt.Errorf("表 %s 的 id 偏移量 %d 小于目标库当前最大 id %d，会产生冲突", tm.Target, n, maxID)
+			}
+			offsets[tm.Target] = n
+		}
+	}
+	for table := range overrides {
+		if _, ok := offsets[table]; !ok {
+			return nil, fmt.Errorf("--id-offset 中的表 %s 不会在合并模式下分配新 id", table)
+		}
+	}
+
+	if persist && cp != nil {
+		if err := cp.setIDOffsets(offsets); err != nil {
+			fmt.Fprintf(console, "⚠️ 写入断点文件失败: %v\n", err)
+		}
+	}
+	fmt.Fprintln(console, "🔀 合并模式：新 id = 源库 id + 偏移量")
+	r := newIDRemap(offsets)
+	r.print()
+	return r, nil
+}
+
+func (r *idRemap) print() {
+	tables := make([]string, 0, len(r.Offsets))
+	for t := range r.Offsets {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	for _, t := range tables {
+		logEvent("id_offset", eventFields{"table": t, "offset": r.Offsets[t]}, "   表 %s 的 id 偏移 +%d\n", t, r.Offsets[t])
+	}
+}
+
+// writeIDMap 把每张分配了新 id 的表的 源库 id -> 目标库 id 写入 CSV，冲突用户同时记录处理方式：
+// table,old_id,new_id,collision,target_id,columns,username。偏移量为 0 且没有冲突的行不写入
+func writeIDMap(oldDB *sql.DB, path string) error {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{"table", "old_id", "new_id", "collision", "target_id", "columns", "username"})
+
+	for _, tm := range mapping.Tables {
+		if !tm.MergeIDs {
+			continue
+		}
+		var offset int64
+		var overrides map[int64]int64
+		if ids != nil {
+			offset, overrides = ids.Offsets[tm.Target], ids.Overrides[tm.Target]
+		}
+		collisions := userCollisions
+		if tm.Target != "users" {
+			collisions = nil
+		}
+		if offset == 0 && len(overrides) == 0 && len(collisions) == 0 {
+			continue
+		}
+		idCol := tm.sourceColumnFor("id")
+		// 按 --logs-since/--logs-until 未迁移的日志不写入对照
+		query, args := withLogsFilter(fmt.Sprintf("SELECT %s FROM %s", quoteIdent(oldDriver, idCol), quoteIdent(oldDriver, tm.Source)), tm, oldDriver)
+		rows, err := oldDB.Query(query+" ORDER BY "+quoteIdent(oldDriver, idCol), args...)
+		if err != nil {
+			return fmt.Errorf("读取源库表 %s 的 id 失败: %w", tm.Source, err)
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			newID, overridden := overrides[id]
+			if !overridden {
+				newID = id + offset
+			}
+			c, collided := collisions[id]
+			switch {
+			case collided:
+				_ = w.Write([]string{tm.Target, strconv.FormatInt(id, 10), strconv.FormatInt(newID, 10),
+					c.Policy, strconv.FormatInt(c.TargetID, 10), strings.Join(c.Columns, "|"), c.Username})
+			case offset != 0 || overridden:
+				_ = w.Write([]string{tm.Target, strconv.FormatInt(id, 10), strconv.FormatInt(newID, 10)})
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// loadIDMap 从 writeIDMap 导出的文件中恢复 id 改写规则与用户冲突的处理方式，供单独运行的 verify 使用；
+// withOffsets 为 false 时（非合并模式）只恢复用户冲突
+func loadIDMap(path string, withOffsets bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := csv.NewReader(bufio.NewReader(f))
+	r.FieldsPerRecord = -1
+	if _, err := r.Read(); err != nil {
+		return fmt.Errorf("读取 id 对照文件 %s 失败: %w", path, err)
+	}
+	offsets := make(map[string]int64)
+	var collisions []userCollision
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取 id 对照文件 %s 失败: %w", path, err)
+		}
+		if len(record) < 3 {
+			continue
+		}
+		oldID, err1 := strconv.ParseInt(record[1], 10, 64)
+		newID, err2 := strconv.ParseInt(record[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("id 对照文件 %s 中的行 %v 无效", path, record)
+		}
+		if len(record) == 7 && record[3] != "" {
+			targetID, err := strconv.ParseInt(record[4], 10, 64)
+			if err != nil {
+				return fmt.Errorf("id 对照文件 %s 中的行 %v 无效", path, record)
+			}
+			c := userCollision{SourceID: oldID, TargetID: targetID, Policy: record[3], Username: record[6]}
+			if record[5] != "" {
+				c.Columns = strings.Split(record[5], "|")
+			}
+			collisions = append(collisions, c)
+			if _, ok := c.finalID(); ok {
+				continue
+			}
+		}
+		if _, ok := offsets[record[0]]; !ok {
+			offsets[record[0]] = newID - oldID
+		}
+	}
+	if withOffsets {
+		ids = newIDRemap(offsets)
+	}
+	useUserCollisions(collisions)
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIDRemapRewrite(t *testing.T) {
+	mapping = defaultMapping()
+	r := newIDRemap(map[string]int64{"users": 100, "channels": 10})
+	r.setOverride("users", 2, 7)
+	tests := []struct {
+		name    string
+		table   string
+		column  string
+		value   any
+		want    any
+		wantErr bool
+	}{
+		{name: "表自身的 id 加偏移量", table: "users", column: "id", value: int64(1), want: int64(101)},
+		{name: "引用列按被引用表的偏移量", table: "tokens", column: "user_id", value: int64(3), want: int64(103)},
+		{name: "logs.channel_id", table: "logs", column: "channel_id", value: int64(3), want: int64(13)},
+		{name: "字符串形式的 id", table: "logs", column: "user_id", value: []byte("4"), want: int64(104)},
+		{name: "指定的 id 优先于偏移量", table: "users", column: "id", value: int64(2), want: int64(7)},
+		{name: "引用列同样使用指定的 id", table: "tokens", column: "user_id", value: int64(2), want: int64(7)},
+		{name: "users.inviter_id", table: "users", column: "inviter_id", value: int64(2), want: int64(7)},
+		{name: "NULL 不变", table: "tokens", column: "user_id", value: nil, want: nil},
+		{name: "0 表示没有引用", table: "users", column: "inviter_id", value: int64(0), want: int64(0)},
+		{name: "不改写的列", table: "users", column: "quota", value: int64(5), want: int64(5)},
+		{name: "abilities.channel_id", table: "abilities", column: "channel_id", value: int64(5), want: int64(15)},
+		{name: "无法解析为整数", table: "tokens", column: "user_id", value: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.rewrite(tt.table, tt.column, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("rewrite(%s.%s, %#v) 应返回错误", tt.table, tt.column, tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rewrite(%s.%s, %#v) = %#v, want %#v", tt.table, tt.column, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// 只有指定 id、没有偏移量时（非合并模式下的冲突用户），其余 id 保持不变
+func TestIDRemapOverridesOnly(t *testing.T) {
+	mapping = defaultMapping()
+	r := newIDRemap(map[string]int64{})
+	r.setOverride("users", 2, 7)
+	for _, tt := range []struct {
+		value, want int64
+	}{{2, 7}, {3, 3}} {
+		got, err := r.rewrite("logs", "user_id", tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != any(tt.want) {
+			t.Errorf("rewrite(logs.user_id, %d) = %#v, want %d", tt.value, got, tt.want)
+		}
+	}
+	if got, _ := r.rewrite("logs", "channel_id", int64(3)); got != any(int64(3)) {
+		t.Errorf("没有偏移量的 channel_id 不应改写，实际为 %#v", got)
+	}
+}
+
+func TestParseIDOffsets(t *testing.T) {
+	got, err := parseIDOffsets(" users=10000, channels = 500 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{"users": 10000, "channels": 500}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIDOffsets = %v, want %v", got, want)
+	}
+	for _, in := range []string{"users", "users=-1", "users=abc"} {
+		if _, err := parseIDOffsets(in); err == nil {
+			t.Errorf("parseIDOffsets(%q) 应返回错误", in)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// readOption 读取目标库 options 表中 key 的值，不存在时 ok 为 false
+func readOption(tx *sql.Tx, driver, key string) (value string, ok bool, err error) {
+	var raw sql.NullString
+	err = tx.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s",
+		quoteIdent(driver, "value"), quoteIdent(driver, "options"), quoteIdent(driver, "key"), placeholderAt(driver, 1)), key).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return raw.String, true, nil
+}
+
+// writeOption 写入目标库 options 表中 key 的值，已存在时覆盖
+func writeOption(tx *sql.Tx, driver, key, value string) error {
+	_, exists, err := readOption(tx, driver, key)
+	if err != nil {
+		return err
+	}
+	var query string
+	if exists {
+		query = fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s = %s", quoteIdent(driver, "options"),
+			quoteIdent(driver, "value"), placeholderAt(driver, 1), quoteIdent(driver, "key"), placeholderAt(driver, 2))
+		_, err = tx.Exec(query, value, key)
+	} else {
+		query = fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (%s, %s)", quoteIdent(driver, "options"),
+			quoteIdent(driver, "key"), quoteIdent(driver, "value"), placeholderAt(driver, 1), placeholderAt(driver, 2))
+		_, err = tx.Exec(query, key, value)
+	}
+	return err
+}
+
+// ratioMerge 是合并倍率配置的结果：新增、修改的条目数，按 --options-policy keep 保留目标库原值的条目数，
+// 以及目标库没有该配置时作为基础写入的内置默认条目数
+type ratioMerge struct {
+	Added   int `json:"added"`
+	Changed int `json:"changed"`
+	Kept    int `json:"kept"`
+	Seeded  int `json:"seeded,omitempty"`
+}
+
+// mergeRatioOption 把 entries 合并进目标库中 JSON 格式的倍率配置（如 ModelRatio）。目标库已有的同名条目
+// 按 --options-policy 处理：overwrite 以 entries 为准，keep 保留原值；目标库没有该配置时在 defaults 的基础上合并，
+// defaults 中的条目总是可以覆盖。目标库中的值不是合法 JSON 时返回错误，避免覆盖掉手工配置
+func mergeRatioOption(tx *sql.Tx, driver, key string, entries, defaults map[string]float64) (ratioMerge, error) {
+	var result ratioMerge
+	if len(entries) == 0 {
+		return result, nil
+	}
+	raw, exists, err := readOption(tx, driver, key)
+	if err != nil {
+		return result, err
+	}
+	merged := make(map[string]float64)
+	configured := exists && raw != ""
+	if configured {
+		if err := json.Unmarshal([]byte(raw), &merged); err != nil {
+			return result, fmt.Errorf("目标库配置项 %s 不是合法的 JSON: %w", key, err)
+		}
+	} else {
+		for name, ratio := range defaults {
+			merged[name] = ratio
+		}
+	}
+	for name, ratio := range entries {
+		old, ok := merged[name]
+		switch {
+		case !ok:
+			result.Added++
+		case old == ratio:
+			continue
+		case configured && config.OptionsPolicy == optionsKeep:
+			result.Kept++
+			continue
+		default:
+			result.Changed++
+		}
+		merged[name] = ratio
+	}
+	if result.Added == 0 && result.Changed == 0 {
+		return result, nil
+	}
+	if !configured {
+		result.Seeded = len(defaults)
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return result, err
+	}
+	return result, writeOption(tx, driver, key, string(data))
+}
+
+// roundRatio 保留 6 位小数，避免 0.3/0.1 这类除法写出 2.9999999999999996
+func roundRatio(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// 配置项冲突时的处理方式（--options-policy），对应 options 表的冲突策略
+const (
+	// optionsKeep 保留目标库管理员已设置的值
+	optionsKeep = "keep"
+	// optionsOverwrite 用源库的值覆盖
+	optionsOverwrite = "overwrite"
+)
+
+func parseOptionsPolicy(s string) (string, error) {
+	switch s = strings.TrimSpace(strings.ToLower(s)); s {
+	case optionsKeep, optionsOverwrite:
+		return s, nil
+	}
+	return "", fmt.Errorf("无效的配置项策略 %q（可选 keep/overwrite）", s)
+}
+
+// optionRule 是 one-hub 配置项迁移到 one-api 的规则
+type optionRule struct {
+	// Target 是 one-api 中的配置项名，为空表示 one-api 没有对应功能，不迁移
+	Target string
+	// Convert 转换配置项的值，为 nil 时原样迁移
+	Convert func(value string) (string, error)
+	// Note 是迁移后需要管理员注意的事项
+	Note string
+}
+
+// optionRules 是内置的配置项转换表：one-hub 配置项 -> 规则。不在表中的配置项原样迁移，
+// 迁移规则文件中的 option_keys 可以扩展或覆盖
+var optionRules = map[string]optionRule{
+	"OIDCAuthEnabled":  {Target: "OidcEnabled"},
+	"OIDCClientId":     {Target: "OidcClientId"},
+	"OIDCClientSecret": {Target: "OidcClientSecret"},
+	// one-hub 填写 Issuer，one-api 填写 Well-Known 地址，授权/令牌/用户信息端点需要在 one-api 后台重新获取
+	"OIDCIssuer": {Target: "OidcWellKnown", Convert: oidcWellKnown, Note: "请在 one-api 后台根据 OidcWellKnown 补全 OIDC 的授权、令牌与用户信息端点"},
+
+	// one-api 中没有对应功能
+	"OIDCScopes":               {},
+	"OIDCUsernameClaims":       {},
+	"LarkAuthEnabled":          {},
+	"GitHubOldIdCloseEnabled":  {},
+	"ChatLinks":                {},
+	"ChatCacheEnabled":         {},
+	"ChatCacheExpireMinute":    {},
+	"RetryCooldownSeconds":     {},
+	"MjNotifyEnabled":          {},
+	"PaymentUSDRate":           {},
+	"PaymentMinAmount":         {},
+	"RechargeDiscount":         {},
+	"CFWorkerImageUrl":         {},
+	"CFWorkerImageKey":         {},
+	"SafeToolEnabled":          {},
+	"SafeToolName":             {},
+	"SafeKeyWords":             {},
+	"DisableChannelKeywords":   {},
+	"GeminiAPIEnabled":         {},
+	"ClaudeAPIEnabled":         {},
+	"UptimeKumaEnabled":        {},
+	"UptimeKumaDomain":         {},
+	"UptimeKumaStatusPageName": {},
+}
+
+// optionRuleFor 返回源库配置项的规则，规则文件中的 option_keys 优先；ok 为 false 表示原样迁移
+func optionRuleFor(key string) (optionRule, bool) {
+	if target, ok := mapping.OptionKeys[key]; ok {
+		rule := optionRule{Target: target}
+		if builtin, ok := optionRules[key]; ok && builtin.Target == target {
+			rule = builtin
+		}
+		return rule, true
+	}
+	rule, ok := optionRules[key]
+	return rule, ok
+}
+
+// oidcWellKnown 把 OIDC Issuer 转换为 Well-Known 配置地址
+func oidcWellKnown(issuer string) (string, error) {
+	issuer = strings.TrimRight(strings.TrimSpace(issuer), "/")
+	if issuer == "" || strings.HasSuffix(issuer, "/.well-known/openid-configuration") {
+		return issuer, nil
+	}
+	return issuer + "/.well-known/openid-configuration", nil
+}
+
+// normalizeBool 把开关类配置项的值统一为 one-api 识别的 true/false
+func normalizeBool(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "on":
+		return "true"
+	case "0", "false", "no", "off", "":
+		return "false"
+	}
+	return value
+}
+
+// transformOptionKey 按配置项转换表改名，one-api 中没有对应功能的配置项整行跳过
+func transformOptionKey(ctx *transformContext, value any) (any, error) {
+	key := valueString(value)
+	rule, ok := optionRuleFor(key)
+	if !ok {
+		return value, nil
+	}
+	if rule.Target == "" {
+		ctx.Group("one-api 中没有对应功能，未迁移", key)
+		return nil, errSkipRow
+	}
+	if rule.Target != key {
+		ctx.Group("改名迁移", key+" -> "+rule.Target)
+	}
+	if rule.Note != "" {
+		ctx.Report("%s: %s", key, rule.Note)
+	}
+	return rule.Target, nil
+}
+
+// transformOptionValue 按配置项转换表转换值，开关类配置项（*Enabled）统一为 true/false
+func transformOptionValue(ctx *transformContext, value any) (any, error) {
+	raw, _ := ctx.Source("key")
+	key := valueString(raw)
+	target := key
+	rule, ok := optionRuleFor(key)
+	if ok {
+		if rule.Target == "" {
+			return nil, errSkipRow
+		}
+		target = rule.Target
+	}
+	if value == nil {
+		return value, nil
+	}
+	s := valueString(value)
+	if ok && rule.Convert != nil {
+		converted, err := rule.Convert(s)
+		if err != nil {
+			ctx.Report("配置项 %s 的值无法转换，未迁移: %v", key, err)
+			return nil, errSkipRow
+		}
+		s = converted
+	}
+	if strings.HasSuffix(target, "Enabled") {
+		s = normalizeBool(s)
+	}
+	return s, nil
+}
+
+// effectiveOptionsConflict 让 --options-policy 决定 options 表的冲突策略，--conflict 中显式配置的 options=... 优先
+func effectiveOptionsConflict(policies conflictPolicies, policy string) conflictPolicies {
+	if _, ok := policies.PerTable["options"]; ok {
+		return policies
+	}
+	if policy == optionsOverwrite {
+		policies.PerTable["options"] = conflictUpsert
+	} else {
+		policies.PerTable["options"] = conflictIgnore
+	}
+	return policies
+}
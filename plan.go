@@ -0,0 +1,318 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tablePlan 是 dry-run 模式下单张表的迁移计划
+type tablePlan struct {
+	Table string
+	// Skipped 非空时表示该表在实际迁移中会被跳过，内容为原因
+	Skipped        string
+	SourceRows     int64
+	Columns        []string
+	DroppedColumns []string
+	Excluded       []string
+	TargetOnly     []string
+	// Renamed 记录改名的列（源列 -> 目标列），Defaults 记录使用常量值的目标列
+	Renamed    map[string]string
+	Folded     map[string]string
+	Defaults   map[string]any
+	Transforms map[string]string
+	// Issues 是逐行转换时转换函数报告的问题与处理汇总（如渠道类型兜底、密钥格式不符）
+	Issues *issueLog
+	// SkippedRows 是按规则跳过、不会写入的行数
+	SkippedRows int64
+	// Window 描述 --logs-since/--logs-until 限定的时间范围，SourceRows 只统计范围内逐行复制的行
+	Window string
+	// RollupBefore 非 0 时该时间之前的 RollupSourceRows 条消费日志将汇总为 RollupRows 行（--logs-rollup-before）
+	RollupBefore     int64
+	RollupSourceRows int64
+	RollupRows       int64
+	Conflict         conflictPolicy
+	// Checkpoint 是断点文件中该表的进度
+	Checkpoint tableCheckpoint
+}
+
+// planMigration 按 main 的迁移顺序执行所有只读步骤并输出迁移计划，不写入目标库。
+// cp 是 runPlan 读取的断点，--restart 时为空断点
+func planMigration(oldDB, newDB *sql.DB, cp *checkpoint) {
+	fmt.Fprintln(console, "🧪 dry-run 模式：只读取源库/目标库，不会写入任何数据")
+	fmt.Fprintln(console, "======================")
+	for _, tm := range mapping.Tables {
+		plan := planTable(oldDB, newDB, tm)
+		plan.Checkpoint = cp.table(tm.name())
+		printTablePlan(plan)
+	}
+
+	fmt.Fprintln(console, "======================")
+	if config.RebuildAbilities {
+		channels, abilities, err := planAbilities(oldDB, newDB)
+		if err != nil {
+			fmt.Fprintf(console, "⚠️ 无法估算 abilities 重建结果: %v\n", err)
+		} else {
+			fmt.Fprintf(console, "🔧 abilities 重建：预计扫描 channels=%d，生成写入行=%d（重复键按 %s 策略处理）\n", channels, abilities, config.Conflict.forTable("abilities"))
+		}
+	} else {
+		fmt.Fprintln(console, "🔧 abilities 重建：已关闭（--rebuild-abilities=false）")
+	}
+	if pricesEnabled() {
+		planPrices(oldDB)
+	}
+	if groupsEnabled() {
+		planGroups(oldDB, newDB)
+	}
+	fmt.Fprintln(console, "======================")
+	fmt.Fprintln(console, "🚩迁移计划输出完成，未写入任何数据🚩")
+}
+
+// planTable 复用 migrateTable 的列解析逻辑，统计源表行数和渠道类型映射结果
+func planTable(oldDB, newDB *sql.DB, tm TableMapping) tablePlan {
+	oldDriver, _ := detectDriver(config.OldDSN)
+
+	plan := tablePlan{Table: tm.name(), Conflict: config.Conflict.forTable(tm.Target)}
+
+	cols, skip := resolveTable(oldDB, newDB, tm)
+	if skip != "" {
+		plan.Skipped = skip
+		return plan
+	}
+	plan.Columns = cols.targetNames()
+	plan.DroppedColumns = cols.Dropped
+	plan.Excluded = cols.Excluded
+	plan.TargetOnly = cols.TargetOnly
+	plan.Folded = cols.Folded
+	plan.Renamed = make(map[string]string)
+	plan.Defaults = make(map[string]any)
+	plan.Transforms = make(map[string]string)
+	for _, c := range cols.Columns {
+		if def, ok := tm.Defaults[c.Target]; ok && c.Source == "" {
+			plan.Defaults[c.Target] = def
+		}
+		if c.Source != "" && c.Source != c.Target {
+			plan.Renamed[c.Source] = c.Target
+		}
+		if c.Transform != "" {
+			plan.Transforms[c.Target] = c.Transform
+		}
+	}
+	if err := checkConflictKeys(tm.Target, plan.Conflict, plan.Columns); err != nil {
+		plan.Skipped = err.Error()
+		return plan
+	}
+
+	plan.Window = logsWindow(tm)
+	query, args := withLogsFilter(fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdent(oldDriver, tm.Source)), tm, oldDriver)
+	err := oldDB.QueryRow(query, args...).Scan(&plan.SourceRows)
+	if err != nil {
+		plan.Skipped = fmt.Sprintf("统计源表行数失败: %v", err)
+		return plan
+	}
+
+	if logsRollupEnabled(tm) {
+		plan.RollupBefore = config.LogsRollupBefore
+		if plan.RollupSourceRows, plan.RollupRows, err = planLogsRollup(oldDB, tm); err != nil {
+			plan.Skipped = fmt.Sprintf("统计汇总的日志失败: %v", err)
+			return plan
+		}
+	}
+
+	for _, c := range cols.Columns {
+		if c.Transform == "" || !transforms[c.Transform].Checks {
+			continue
+		}
+		issues, skipped, err := planRowIssues(oldDB, oldDriver, tm, cols)
+		if err != nil {
+			plan.Skipped = fmt.Sprintf("转换源表数据失败: %v", err)
+			return plan
+		}
+		plan.Issues = issues
+		plan.SkippedRows = skipped
+		break
+	}
+	return plan
+}
+
+// planRowIssues 按迁移规则转换源表的每一行（不写入），收集转换函数报告的问题并统计跳过的行
+func planRowIssues(oldDB *sql.DB, oldDriver string, tm TableMapping, cols resolvedColumns) (*issueLog, int64, error) {
+	quoted := make([]string, 0, len(cols.SourceColumns))
+	for _, col := range cols.SourceColumns {
+		quoted = append(quoted, quoteIdent(oldDriver, col))
+	}
+	query, args := withLogsFilter(fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ","), quoteIdent(oldDriver, tm.Source)), tm, oldDriver)
+	rows, err := oldDB.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	values := make([]any, len(cols.SourceColumns))
+	ptrs := make([]any, len(cols.SourceColumns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	issues := &issueLog{}
+	var skipped int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, 0, err
+		}
+		_, err := buildInsertValues(values, cols, tm.Target, convertOptions{Issues: issues})
+		switch {
+		case errors.Is(err, errSkipRow):
+			skipped++
+		case err != nil:
+			return nil, 0, err
+		}
+	}
+	return issues, skipped, rows.Err()
+}
+
+// planAbilities 估算 rebuildTargetAbilitiesFromChannels 在迁移后会生成的行数：
+// 目标库已有的 channels 加上将从源库写入的 channels（id 冲突时保留目标库的行，与 INSERT IGNORE 一致）
+func planAbilities(oldDB, newDB *sql.DB) (int, int, error) {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+
+	newColumns := getColumns(newDB, "channels", newDriver)
+	if len(getColumns(newDB, "abilities", newDriver)) == 0 {
+		return 0, 0, fmt.Errorf("目标库中没有找到表: abilities")
+	}
+	for _, col := range []string{"id", "group", "models", "status"} {
+		if !contains(newColumns, col) {
+			return 0, 0, fmt.Errorf("目标库 channels 缺少字段 %s", col)
+		}
+	}
+
+	channels := make(map[int64][2]string)
+	if err := loadChannelGroupsModels(newDB, newDriver, "channels", "id", "group", "models", channels); err != nil {
+		return 0, 0, err
+	}
+	for _, tm := range mapping.Tables {
+		if tm.Target != "channels" {
+			continue
+		}
+		cols, skip := resolveTable(oldDB, newDB, tm)
+		if skip != "" {
+			continue
+		}
+		id, group, models := cols.sourceFor("id"), cols.sourceFor("group"), cols.sourceFor("models")
+		if id == "" || group == "" || models == "" {
+			continue
+		}
+		if err := loadChannelGroupsModels(oldDB, oldDriver, tm.Source, id, group, models, channels); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	abilities := 0
+	for _, ch := range channels {
+		abilities += len(channelAbilities(ch[0], ch[1]))
+	}
+	return len(channels), abilities, nil
+}
+
+// loadChannelGroupsModels 读取渠道表的 id/group/models，已存在的 id 不覆盖
+func loadChannelGroupsModels(db *sql.DB, driver, table, idCol, groupCol, modelsCol string, channels map[int64][2]string) error {
+	query := fmt.Sprintf(
+		"SELECT %s,%s,%s FROM %s",
+		quoteIdent(driver, idCol),
+		quoteIdent(driver, groupCol),
+		quoteIdent(driver, modelsCol),
+		quoteIdent(driver, table),
+	)
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id     int64
+			group  sql.NullString
+			models sql.NullString
+		)
+		if err := rows.Scan(&id, &group, &models); err != nil {
+			return err
+		}
+		if _, ok := channels[id]; ok {
+			continue
+		}
+		channels[id] = [2]string{group.String, models.String}
+	}
+	return rows.Err()
+}
+
+func printTablePlan(plan tablePlan) {
+	fmt.Fprintf(console, "📋 表: %s\n", plan.Table)
+	if plan.Skipped != "" {
+		fmt.Fprintf(console, "   ⚠️ 将跳过: %s\n", plan.Skipped)
+		return
+	}
+	fmt.Fprintf(console, "   源库行数: %d\n", plan.SourceRows)
+	if plan.Window != "" {
+		fmt.Fprintf(console, "   时间范围: 只迁移 %s 的行\n", plan.Window)
+	}
+	if plan.RollupBefore > 0 {
+		fmt.Fprintf(console, "   汇总: %s 之前的 %d 条消费日志将汇总为 %d 行（每个用户、模型每天一行），源库行数不含这些日志\n",
+			time.Unix(plan.RollupBefore, 0).Format("2006-01-02 15:04:05"), plan.RollupSourceRows, plan.RollupRows)
+	}
+	if plan.Checkpoint.Done {
+		fmt.Fprintf(console, "   断点: 之前的运行已完成（%d 行），将跳过\n", plan.Checkpoint.Rows)
+	} else if len(plan.Checkpoint.Ranges) > 0 {
+		pending := 0
+		for _, r := range plan.Checkpoint.Ranges {
+			if !r.Done {
+				pending++
+			}
+		}
+		fmt.Fprintf(console, "   断点: 按 id 区间并发迁移，%d/%d 个区间未完成（已迁移 %d 行）\n", pending, len(plan.Checkpoint.Ranges), plan.Checkpoint.Rows)
+	} else if plan.Checkpoint.Rows > 0 {
+		fmt.Fprintf(console, "   断点: 将从 id > %d 继续（已迁移 %d 行）\n", plan.Checkpoint.LastID, plan.Checkpoint.Rows)
+	}
+	fmt.Fprintf(console, "   迁移字段(%d): %v\n", len(plan.Columns), plan.Columns)
+	fmt.Fprintf(console, "   主键冲突策略: %s\n", plan.Conflict)
+	if len(plan.DroppedColumns) > 0 {
+		fmt.Fprintf(console, "   ⚠️ 丢弃字段(目标库没有): %v\n", plan.DroppedColumns)
+	}
+	if len(plan.Excluded) > 0 {
+		fmt.Fprintf(console, "   按规则排除字段: %v\n", plan.Excluded)
+	}
+	if len(plan.TargetOnly) > 0 {
+		fmt.Fprintf(console, "   目标库独有字段(使用默认值): %v\n", plan.TargetOnly)
+	}
+	for _, src := range sortedKeys(plan.Renamed) {
+		fmt.Fprintf(console, "   改名: %s -> %s\n", src, plan.Renamed[src])
+	}
+	for _, src := range sortedKeys(plan.Folded) {
+		fmt.Fprintf(console, "   合并进 JSON: %s -> %s\n", src, plan.Folded[src])
+	}
+	for _, col := range sortedKeys(plan.Defaults) {
+		fmt.Fprintf(console, "   常量: %s = %v\n", col, plan.Defaults[col])
+	}
+	for _, col := range sortedKeys(plan.Transforms) {
+		fmt.Fprintf(console, "   转换: %s 使用 %s\n", col, plan.Transforms[col])
+	}
+	if plan.SkippedRows > 0 {
+		fmt.Fprintf(console, "   ⏭️ 按规则跳过: %d 行\n", plan.SkippedRows)
+	}
+	if plan.Issues != nil && !plan.Issues.empty() {
+		fmt.Fprintf(console, "   📋 转换汇总（格式不符的值将原样写入）:\n")
+		plan.Issues.print("      ")
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
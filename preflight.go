@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// preflight 在写入前检查两端数据库：输出驱动与版本，拒绝源库与目标库为同一个库，
+// 确认迁移规则中的表存在，在回滚的事务中确认目标库账号可以写入这些表，
+// 并按 --allow-non-empty/--truncate-target/--append 检查目标库表中是否已有数据。
+// readOnly 为 true 时（plan/--dry-run）不对目标库执行 INSERT，只在能通过权限查询确认时检查写入权限
+func preflight(oldDB, newDB *sql.DB, cp *checkpoint, readOnly bool) error {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+	oldVersion := serverVersion(oldDB, oldDriver)
+	newVersion := serverVersion(newDB, newDriver)
+
+	fmt.Fprintln(console, "🛫 预检")
+	logEvent("preflight", eventFields{"source_driver": oldDriver, "source_version": oldVersion, "target_driver": newDriver, "target_version": newVersion},
+		"   源库: %s %s\n   目标库: %s %s\n", oldDriver, oldVersion, newDriver, newVersion)
+
+	var problems []string
+	same, err := sameDatabase(oldDB, oldDriver, newDB, newDriver)
+	switch {
+	case err != nil:
+		fmt.Fprintf(console, "   ⚠️ 无法确认源库与目标库是否为同一个库: %v\n", err)
+	case same:
+		problems = append(problems, "源库与目标库指向同一个数据库")
+	}
+
+	probed := make(map[string]bool)
+	var unchecked []string
+	for _, tm := range mapping.Tables {
+		if ok, err := tableExists(oldDB, oldDriver, tm.Source); err != nil {
+			problems = append(problems, fmt.Sprintf("检查源库表 %s 失败: %v", tm.Source, err))
+		} else if !ok {
+			fmt.Fprintf(console, "   ⚠️ 源库中没有表 %s，迁移时将跳过\n", tm.Source)
+		}
+
+		if probed[tm.Target] {
+			continue
+		}
+		probed[tm.Target] = true
+		ok, err := tableExists(newDB, newDriver, tm.Target)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("检查目标库表 %s 失败: %v", tm.Target, err))
+		case !ok:
+			problems = append(problems, fmt.Sprintf("目标库中没有表 %s（请先启动一次 one-api 完成建表）", tm.Target))
+		case readOnly:
+			allowed, checked, err := hasInsertPrivilege(newDB, newDriver, tm.Target)
+			switch {
+			case err != nil:
+				problems = append(problems, fmt.Sprintf("查询目标库表 %s 的写入权限失败: %v", tm.Target, err))
+			case !checked:
+				unchecked = append(unchecked, tm.Target)
+			case !allowed:
+				problems = append(problems, fmt.Sprintf("目标库账号没有表 %s 的 INSERT 权限", tm.Target))
+			}
+		default:
+			if err := probeInsert(newDB, newDriver, tm.Target); err != nil {
+				problems = append(problems, fmt.Sprintf("目标库账号无法写入表 %s: %v", tm.Target, err))
+			}
+		}
+	}
+	if len(unchecked) > 0 {
+		fmt.Fprintf(console, "   ℹ️ 预览不写入目标库，未检查目标库账号对 %s 的写入权限（migrate 时检查）\n", strings.Join(unchecked, ", "))
+	}
+
+	rows, err := checkTargetRows(newDB, cp)
+	if err != nil {
+		rows = []string{err.Error()}
+	}
+	problems = append(problems, rows...)
+
+	if len(problems) == 0 {
+		fmt.Fprintln(console, "   ✅ 预检通过")
+		return nil
+	}
+	for _, p := range problems {
+		fmt.Fprintf(console, "   ❌ %s\n", p)
+	}
+	logEvent("preflight_failed", eventFields{"problems": problems}, "⛔ 预检未通过（%d 项），未写入任何数据；确认无误后可用 --skip-preflight 跳过\n", len(problems))
+	return fmt.Errorf("预检未通过: %s", strings.Join(problems, "；"))
+}
+
+// serverVersion 返回数据库服务端版本，读取失败时返回 "未知"
+func serverVersion(db *sql.DB, driver string) string {
+	query := "SELECT VERSION()"
+	switch driver {
+	case "postgres":
+		query = "SELECT version()"
+	case "sqlite":
+		query = "SELECT sqlite_version()"
+	}
+	var version string
+	if err := db.QueryRow(query).Scan(&version); err != nil {
+		return "未知"
+	}
+	return version
+}
+
+// tableExists 查询系统表确认表是否存在，与 getColumns 不同，查询出错时返回错误
+func tableExists(db *sql.DB, driver, table string) (bool, error) {
+	var query string
+	switch driver {
+	case "mysql":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	case "postgres":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+	default:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	}
+	var n int
+	if err := db.QueryRow(query, table).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// probeInsert 在事务中执行一条不插入任何行的 INSERT 并回滚，用来确认写入权限
+func probeInsert(db *sql.DB, driver, table string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	t := quoteIdent(driver, table)
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE 1 = 0", t, t))
+	return err
+}
+
+// hasInsertPrivilege 用只读的权限查询确认目标库账号可以写入表 table，不执行任何写入。
+// 只有 Postgres 能直接查询表级权限（has_table_privilege）；MySQL 的权限可能来自库级、全局授权或角色，
+// SQLite 取决于文件权限，这两种情况 checked 为 false
+func hasInsertPrivilege(db *sql.DB, driver, table string) (allowed, checked bool, err error) {
+	if driver != "postgres" {
+		return false, false, nil
+	}
+	err = db.QueryRow("SELECT has_table_privilege(quote_ident(current_schema()) || '.' || quote_ident($1), 'INSERT')", table).Scan(&allowed)
+	return allowed, err == nil, err
+}
+
+// sameDatabase 用服务端自身报告的身份判断两个连接是否指向同一个库，
+// 同一个库换了主机名、端口写法或相对路径时连接串比较不出来
+func sameDatabase(oldDB *sql.DB, oldDriver string, newDB *sql.DB, newDriver string) (bool, error) {
+	if oldDriver != newDriver {
+		return false, nil
+	}
+	oldID, err := databaseIdentity(oldDB, oldDriver)
+	if err != nil {
+		return false, err
+	}
+	newID, err := databaseIdentity(newDB, newDriver)
+	if err != nil {
+		return false, err
+	}
+	return oldID != "" && oldID == newID, nil
+}
+
+// databaseIdentity 返回能区分数据库实例与库名的字符串，内存中的 SQLite 库返回空
+func databaseIdentity(db *sql.DB, driver string) (string, error) {
+	switch driver {
+	case "mysql":
+		var host, database sql.NullString
+		var port int64
+		err := db.QueryRow("SELECT @@hostname, @@port, DATABASE()").Scan(&host, &port, &database)
+		return fmt.Sprintf("%s:%d/%s", host.String, port, database.String), err
+	case "postgres":
+		// 启动时间区分同一主机上的不同实例，且与客户端使用的地址无关
+		var database, started string
+		err := db.QueryRow("SELECT current_database(), pg_postmaster_start_time()::text").Scan(&database, &started)
+		return started + "/" + database, err
+	default:
+		rows, err := db.Query("PRAGMA database_list")
+		if err != nil {
+			return "", err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var seq int
+			var name, file string
+			if err := rows.Scan(&seq, &name, &file); err != nil {
+				return "", err
+			}
+			if name == "main" {
+				return file, nil
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", errors.New("PRAGMA database_list 没有返回 main 库")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// one-hub prices 表的计费方式
+const (
+	oneHubPriceTokens = "tokens"
+	oneHubPriceTimes  = "times"
+)
+
+// oneHubPrice 是 one-hub prices 表的一行。Input/Output 与 one-api 的倍率单位相同：1 = $0.002 / 1K tokens
+type oneHubPrice struct {
+	Model  string
+	Type   string
+	Input  float64
+	Output float64
+	// ExtraRatios 是 one-hub 为缓存、音频等 token 单独设置的倍率（JSON），one-api 没有对应配置
+	ExtraRatios string
+}
+
+// priceConversion 是 one-hub 价格转换为 one-api ModelRatio/CompletionRatio 的结果
+type priceConversion struct {
+	Prices          int
+	ModelRatio      map[string]float64
+	CompletionRatio map[string]float64
+	// Unsupported 是无法用倍率表达、未迁移的模型及原因，Partial 是只迁移了部分价格的模型
+	Unsupported []string
+	Partial     []string
+}
+
+// readOneHubPrices 读取源库 prices 表，表不存在时 ok 为 false
+func readOneHubPrices(oldDB *sql.DB) (prices []oneHubPrice, ok bool, err error) {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	columns := getColumns(oldDB, "prices", oldDriver)
+	if len(columns) == 0 {
+		return nil, false, nil
+	}
+	selected := []string{"model", "type", "input", "output"}
+	for _, col := range selected {
+		if indexOf(columns, col) == -1 {
+			return nil, true, fmt.Errorf("源库 prices 表缺少列 %s", col)
+		}
+	}
+	if indexOf(columns, "extra_ratios") != -1 {
+		selected = append(selected, "extra_ratios")
+	}
+	quoted := make([]string, len(selected))
+	for i, col := range selected {
+		quoted[i] = quoteIdent(oldDriver, col)
+	}
+	rows, err := oldDB.Query(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s",
+		strings.Join(quoted, ", "), quoteIdent(oldDriver, "prices"), quoteIdent(oldDriver, "model")))
+	if err != nil {
+		return nil, true, err
+	}
+	defer rows.Close()
+
+	values := make([]any, len(selected))
+	ptrs := make([]any, len(selected))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, true, err
+		}
+		p := oneHubPrice{Model: valueString(values[0]), Type: strings.ToLower(valueString(values[1]))}
+		if p.Input, err = parsePrice(values[2]); err != nil {
+			return nil, true, fmt.Errorf("模型 %s 的 input 无效: %w", p.Model, err)
+		}
+		if p.Output, err = parsePrice(values[3]); err != nil {
+			return nil, true, fmt.Errorf("模型 %s 的 output 无效: %w", p.Model, err)
+		}
+		if len(values) > 4 {
+			p.ExtraRatios = strings.TrimSpace(valueString(values[4]))
+		}
+		prices = append(prices, p)
+	}
+	return prices, true, rows.Err()
+}
+
+func parsePrice(value any) (float64, error) {
+	s := strings.TrimSpace(valueString(value))
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// convertPrices 把 one-hub 的价格转换为 one-api 的倍率：ModelRatio 取输入价格，
+// CompletionRatio 取输出价格与输入价格之比。按次计费、输入价格为 0 而输出价格不为 0 的模型无法表达
+func convertPrices(prices []oneHubPrice) priceConversion {
+	conv := priceConversion{
+		Prices:          len(prices),
+		ModelRatio:      make(map[string]float64),
+		CompletionRatio: make(map[string]float64),
+	}
+	for _, p := range prices {
+		switch {
+		case p.Model == "":
+			continue
+		case p.Type == oneHubPriceTimes:
+			conv.Unsupported = append(conv.Unsupported, fmt.Sprintf("%s: 按次计费（%g），one-api 只支持按 token 倍率计费", p.Model, p.Input))
+			continue
+		case p.Type != oneHubPriceTokens && p.Type != "":
+			conv.Unsupported = append(conv.Unsupported, fmt.Sprintf("%s: 未知的计费方式 %q", p.Model, p.Type))
+			continue
+		case p.Input < 0 || p.Output < 0:
+			conv.Unsupported = append(conv.Unsupported, fmt.Sprintf("%s: 价格为负数（input=%g, output=%g）", p.Model, p.Input, p.Output))
+			continue
+		case p.Input == 0 && p.Output > 0:
+			conv.Unsupported = append(conv.Unsupported, fmt.Sprintf("%s: 输入价格为 0、输出价格为 %g，无法用补全倍率表示", p.Model, p.Output))
+			continue
+		}
+		conv.ModelRatio[p.Model] = roundRatio(p.Input)
+		if p.Input > 0 {
+			conv.CompletionRatio[p.Model] = roundRatio(p.Output / p.Input)
+		}
+		if p.ExtraRatios != "" && p.ExtraRatios != "{}" && p.ExtraRatios != "null" {
+			conv.Partial = append(conv.Partial, fmt.Sprintf("%s: extra_ratios %s 未迁移", p.Model, p.ExtraRatios))
+		}
+	}
+	sort.Strings(conv.Unsupported)
+	sort.Strings(conv.Partial)
+	return conv
+}
+
+func (c priceConversion) print() {
+	if len(c.Unsupported) > 0 {
+		fmt.Fprintf(console, "   ⚠️ %d 个模型的价格无法用 one-api 的倍率表达，未迁移:\n", len(c.Unsupported))
+		for _, item := range c.Unsupported {
+			fmt.Fprintf(console, "      - %s\n", item)
+		}
+	}
+	if len(c.Partial) > 0 {
+		fmt.Fprintf(console, "   ⚠️ %d 个模型只迁移了输入/输出价格:\n", len(c.Partial))
+		for _, item := range c.Partial {
+			fmt.Fprintf(console, "      - %s\n", item)
+		}
+	}
+}
+
+// migratePrices 把 one-hub prices 表转换为目标库 options 中的 ModelRatio/CompletionRatio，
+// 与目标库已有的配置合并（同名模型以 one-hub 的价格为准），在一个事务中写入
+func migratePrices(oldDB, newDB *sql.DB) error {
+	prices, ok, err := readOneHubPrices(oldDB)
+	if err != nil {
+		return fmt.Errorf("读取源库 prices 表失败: %w", err)
+	}
+	if !ok {
+		fmt.Fprintln(console, "⚠️ 源库中没有找到表: prices，跳过价格迁移")
+		return nil
+	}
+	conv := convertPrices(prices)
+
+	newDriver, _ := detectDriver(config.NewDSN)
+	tx, err := newDB.Begin()
+	if err != nil {
+		return err
+	}
+	model, err := mergeRatioOption(tx, newDriver, "ModelRatio", conv.ModelRatio, nil)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	completion, err := mergeRatioOption(tx, newDriver, "CompletionRatio", conv.CompletionRatio, nil)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	logEvent("prices_migrated", eventFields{
+		"prices":             conv.Prices,
+		"model_ratio":        model,
+		"completion_ratio":   completion,
+		"unsupported":        conv.Unsupported,
+		"partially_migrated": conv.Partial,
+	}, "💰 已把 %d 条 one-hub 价格写入 ModelRatio（新增 %d、修改 %d、保留目标库原值 %d）与 CompletionRatio（新增 %d、修改 %d、保留目标库原值 %d）\n",
+		len(conv.ModelRatio), model.Added, model.Changed, model.Kept, completion.Added, completion.Changed, completion.Kept)
+	conv.print()
+	return nil
+}
+
+// planPrices 输出价格迁移的预览，不写入目标库
+func planPrices(oldDB *sql.DB) {
+	prices, ok, err := readOneHubPrices(oldDB)
+	switch {
+	case err != nil:
+		fmt.Fprintf(console, "⚠️ 无法读取源库 prices 表: %v\n", err)
+		return
+	case !ok:
+		fmt.Fprintln(console, "💰 价格迁移：源库中没有 prices 表，将跳过")
+		return
+	}
+	conv := convertPrices(prices)
+	fmt.Fprintf(console, "💰 价格迁移：%d 条 one-hub 价格，将写入 ModelRatio %d 项、CompletionRatio %d 项\n",
+		conv.Prices, len(conv.ModelRatio), len(conv.CompletionRatio))
+	conv.print()
+}
+
+// pricesEnabled 表示本次运行是否迁移价格：价格写入 options 表，只在迁移 options 时进行
+func pricesEnabled() bool {
+	_, ok := mapping.tableFor("options")
+	return config.MigratePrices && ok
+}
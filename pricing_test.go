@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConvertPrices(t *testing.T) {
+	tests := []struct {
+		name        string
+		price       oneHubPrice
+		model       map[string]float64
+		completion  map[string]float64
+		unsupported int
+		partial     int
+	}{
+		{
+			name:       "按 token 计费",
+			price:      oneHubPrice{Model: "gpt-4o", Type: oneHubPriceTokens, Input: 1.25, Output: 5},
+			model:      map[string]float64{"gpt-4o": 1.25},
+			completion: map[string]float64{"gpt-4o": 4},
+		},
+		{
+			name:       "没有计费方式按 token",
+			price:      oneHubPrice{Model: "m", Input: 0.3, Output: 0.1},
+			model:      map[string]float64{"m": 0.3},
+			completion: map[string]float64{"m": 0.333333},
+		},
+		{
+			name:       "免费模型",
+			price:      oneHubPrice{Model: "free", Type: oneHubPriceTokens},
+			model:      map[string]float64{"free": 0},
+			completion: map[string]float64{},
+		},
+		{name: "没有模型名", price: oneHubPrice{Type: oneHubPriceTokens, Input: 1}},
+		{name: "按次计费", price: oneHubPrice{Model: "dall-e-3", Type: oneHubPriceTimes, Input: 20}, unsupported: 1},
+		{name: "未知计费方式", price: oneHubPrice{Model: "m", Type: "seconds", Input: 1}, unsupported: 1},
+		{name: "负数价格", price: oneHubPrice{Model: "m", Type: oneHubPriceTokens, Input: -1, Output: 1}, unsupported: 1},
+		{name: "输入价格为 0", price: oneHubPrice{Model: "m", Type: oneHubPriceTokens, Output: 2}, unsupported: 1},
+		{
+			name:       "extra_ratios 未迁移",
+			price:      oneHubPrice{Model: "gpt-4o", Type: oneHubPriceTokens, Input: 1, Output: 4, ExtraRatios: `{"cached_tokens":0.5}`},
+			model:      map[string]float64{"gpt-4o": 1},
+			completion: map[string]float64{"gpt-4o": 4},
+			partial:    1,
+		},
+		{
+			name:       "空的 extra_ratios",
+			price:      oneHubPrice{Model: "gpt-4o", Type: oneHubPriceTokens, Input: 1, Output: 4, ExtraRatios: "{}"},
+			model:      map[string]float64{"gpt-4o": 1},
+			completion: map[string]float64{"gpt-4o": 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conv := convertPrices([]oneHubPrice{tt.price})
+			if tt.model == nil {
+				tt.model = map[string]float64{}
+			}
+			if tt.completion == nil {
+				tt.completion = map[string]float64{}
+			}
+			if conv.Prices != 1 {
+				t.Errorf("Prices = %d, want 1", conv.Prices)
+			}
+			if !reflect.DeepEqual(conv.ModelRatio, tt.model) {
+				t.Errorf("ModelRatio = %v, want %v", conv.ModelRatio, tt.model)
+			}
+			if !reflect.DeepEqual(conv.CompletionRatio, tt.completion) {
+				t.Errorf("CompletionRatio = %v, want %v", conv.CompletionRatio, tt.completion)
+			}
+			if len(conv.Unsupported) != tt.unsupported {
+				t.Errorf("Unsupported = %v, want %d 项", conv.Unsupported, tt.unsupported)
+			}
+			if len(conv.Partial) != tt.partial {
+				t.Errorf("Partial = %v, want %d 项", conv.Partial, tt.partial)
+			}
+		})
+	}
+}
+
+func TestMergeRatioOption(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		policy   string
+		want     map[string]float64
+		result   ratioMerge
+	}{
+		{
+			name:   "目标库没有配置时只写入迁移的条目",
+			policy: optionsKeep,
+			want:   map[string]float64{"gpt-4o": 1.25, "custom": 1},
+			result: ratioMerge{Added: 2},
+		},
+		{
+			name:     "keep 保留目标库已设置的值",
+			existing: `{"gpt-4o": 3, "mine": 7}`,
+			policy:   optionsKeep,
+			want:     map[string]float64{"gpt-4o": 3, "mine": 7, "custom": 1},
+			result:   ratioMerge{Added: 1, Kept: 1},
+		},
+		{
+			name:     "overwrite 以源库为准",
+			existing: `{"gpt-4o": 3, "mine": 7}`,
+			policy:   optionsOverwrite,
+			want:     map[string]float64{"gpt-4o": 1.25, "mine": 7, "custom": 1},
+			result:   ratioMerge{Added: 1, Changed: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dst.db")
+			execSQL(t, path, "CREATE TABLE options (key text primary key, value text)")
+			db := openTestDB(t, path)
+			if tt.existing != "" {
+				if _, err := db.Exec("INSERT INTO options VALUES ('ModelRatio', ?)", tt.existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+			config = Config{OptionsPolicy: tt.policy}
+			t.Cleanup(func() { config = Config{} })
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := mergeRatioOption(tx, "sqlite", "ModelRatio", map[string]float64{"gpt-4o": 1.25, "custom": 1}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.result {
+				t.Errorf("mergeRatioOption = %+v, want %+v", result, tt.result)
+			}
+			var raw string
+			if err := db.QueryRow("SELECT value FROM options WHERE key = 'ModelRatio'").Scan(&raw); err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]float64
+			if err := json.Unmarshal([]byte(raw), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ModelRatio = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
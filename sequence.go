@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// idTables 返回迁移规则中以 id 为主键的目标表
+func idTables() []string {
+	var tables []string
+	for _, tm := range mapping.Tables {
+		if len(tm.Key) == 1 && tm.Key[0] == "id" {
+			tables = append(tables, tm.Target)
+		}
+	}
+	return tables
+}
+
+// resetSequences 把目标表的自增序列调整到 max(id)+1：迁移与恢复写入的是显式 id，
+// Postgres 的序列不会随之前进，one-api 之后新增的行会与已有 id 冲突。
+// Postgres 使用 setval，MySQL 使用 ALTER TABLE ... AUTO_INCREMENT，SQLite 修正 sqlite_sequence；
+// 序列已经大于 max(id) 时保持不变。返回失败的表数
+func resetSequences(newDB *sql.DB, tables []string) int {
+	newDriver, _ := detectDriver(config.NewDSN)
+	failed := 0
+	for _, table := range tables {
+		if ok, err := tableExists(newDB, newDriver, table); err != nil || !ok {
+			continue
+		}
+		maxID, err := targetMaxID(newDB, table)
+		if err != nil {
+			fmt.Fprintf(console, "⚠️ 查询目标库表 %s 的最大 id 失败: %v\n", table, err)
+			failed++
+			continue
+		}
+		if maxID <= 0 {
+			continue
+		}
+		var next int64
+		switch newDriver {
+		case "postgres":
+			next, err = resetPostgresSequence(newDB, table, maxID)
+		case "mysql":
+			next, err = resetMySQLAutoIncrement(newDB, table, maxID)
+		default:
+			next, err = resetSQLiteSequence(newDB, table, maxID)
+		}
+		if err != nil {
+			fmt.Fprintf(console, "⚠️ 调整目标库表 %s 的自增序列失败: %v\n", table, err)
+			failed++
+			continue
+		}
+		if next > 0 {
+			logEvent("sequence_reset", eventFields{"table": table, "next_id": next},
+				"🔢 表 %s 的自增序列已调整，下一个 id 为 %d\n", table, next)
+		}
+	}
+	return failed
+}
+
+// resetPostgresSequence 调整 id 列所属的序列（serial 或 identity），没有序列时返回 0
+func resetPostgresSequence(db *sql.DB, table string, maxID int64) (int64, error) {
+	var seq sql.NullString
+	if err := db.QueryRow("SELECT pg_get_serial_sequence($1, 'id')", quoteIdent("postgres", table)).Scan(&seq); err != nil {
+		return 0, err
+	}
+	if !seq.Valid {
+		return 0, nil
+	}
+	var lastValue int64
+	var isCalled bool
+	if err := db.QueryRow("SELECT last_value, is_called FROM "+seq.String).Scan(&lastValue, &isCalled); err != nil {
+		return 0, err
+	}
+	next := lastValue
+	if isCalled {
+		next++
+	}
+	if next > maxID {
+		return 0, nil
+	}
+	// is_called 为 true 时下一次 nextval 返回 maxID+1
+	if _, err := db.Exec("SELECT setval($1, $2, true)", seq.String, maxID); err != nil {
+		return 0, err
+	}
+	return maxID + 1, nil
+}
+
+// resetMySQLAutoIncrement 调整表的 AUTO_INCREMENT，表没有自增列时返回 0
+func resetMySQLAutoIncrement(db *sql.DB, table string, maxID int64) (int64, error) {
+	var current sql.NullInt64
+	err := db.QueryRow("SELECT AUTO_INCREMENT FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", table).Scan(&current)
+	if err != nil {
+		return 0, err
+	}
+	if !current.Valid || current.Int64 > maxID {
+		return 0, nil
+	}
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d", quoteIdent("mysql", table), maxID+1)); err != nil {
+		return 0, err
+	}
+	return maxID + 1, nil
+}
+
+// resetSQLiteSequence 修正 AUTOINCREMENT 表在 sqlite_sequence 中的记录；没有声明 AUTOINCREMENT 的表
+// 按 max(rowid)+1 分配 id，不需要调整，返回 0
+func resetSQLiteSequence(db *sql.DB, table string, maxID int64) (int64, error) {
+	var createSQL string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&createSQL); err != nil {
+		return 0, err
+	}
+	if !strings.Contains(strings.ToUpper(createSQL), "AUTOINCREMENT") {
+		return 0, nil
+	}
+	var seq sql.NullInt64
+	err := db.QueryRow("SELECT seq FROM sqlite_sequence WHERE name = ?", table).Scan(&seq)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = db.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES (?, ?)", table, maxID)
+	case err != nil:
+		return 0, err
+	case seq.Int64 >= maxID:
+		return 0, nil
+	default:
+		_, err = db.Exec("UPDATE sqlite_sequence SET seq = ? WHERE name = ?", maxID, table)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return maxID + 1, nil
+}
+
+// runResetSequences 是 reset-sequences 子命令，只需要目标库
+func runResetSequences() int {
+	fmt.Fprintln(console, "🔢 正在调整目标库各表的自增序列")
+	if resetSequences(openDatabase(config.NewDSN), idTables()) > 0 {
+		return exitTablesFailed
+	}
+	return exitOK
+}
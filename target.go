@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// targetMode 决定目标库表中已有数据时的处理方式
+type targetMode string
+
+const (
+	// targetRequireEmpty 是默认方式：目标库表非空时拒绝迁移
+	targetRequireEmpty targetMode = "require-empty"
+	// targetAllowNonEmpty 照常写入，与已有行的冲突按 --conflict 处理
+	targetAllowNonEmpty targetMode = "allow-non-empty"
+	// targetTruncate 在迁移前清空目标库中非空的表
+	targetTruncate targetMode = "truncate"
+	// targetAppend 只迁移 id 大于目标库最大 id 的行
+	targetAppend targetMode = "append"
+	// targetMerge 为带 merge_ids 的表分配新 id，并改写引用这些表的列
+	targetMerge targetMode = "merge"
+)
+
+// parseTargetMode 由 --allow-non-empty、--truncate-target、--append、--merge 得到处理方式，只能选一个
+func parseTargetMode(allowNonEmpty, truncate, appendRows, merge bool) (targetMode, error) {
+	var modes []targetMode
+	if allowNonEmpty {
+		modes = append(modes, targetAllowNonEmpty)
+	}
+	if truncate {
+		modes = append(modes, targetTruncate)
+	}
+	if appendRows {
+		modes = append(modes, targetAppend)
+	}
+	if merge {
+		modes = append(modes, targetMerge)
+	}
+	switch len(modes) {
+	case 0:
+		return targetRequireEmpty, nil
+	case 1:
+		return modes[0], nil
+	default:
+		return "", fmt.Errorf("--allow-non-empty、--truncate-target、--append、--merge 只能选择一个")
+	}
+}
+
+// targetTableRows 是目标库中一张非空表的行数
+type targetTableRows struct {
+	Table string
+	Rows  int64
+}
+
+// nonEmptyTargetTables 统计迁移规则中每张目标表的行数，返回非空的表；不存在的表忽略
+func nonEmptyTargetTables(newDB *sql.DB) ([]targetTableRows, error) {
+	newDriver, _ := detectDriver(config.NewDSN)
+	var tables []targetTableRows
+	seen := make(map[string]bool)
+	for _, tm := range mapping.Tables {
+		if seen[tm.Target] {
+			continue
+		}
+		seen[tm.Target] = true
+		if ok, err := tableExists(newDB, newDriver, tm.Target); err != nil || !ok {
+			continue
+		}
+		var rows int64
+		if err := newDB.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdent(newDriver, tm.Target))).Scan(&rows); err != nil {
+			return nil, fmt.Errorf("统计目标库表 %s 的行数失败: %w", tm.Target, err)
+		}
+		if rows > 0 {
+			tables = append(tables, targetTableRows{Table: tm.Target, Rows: rows})
+		}
+	}
+	return tables, nil
+}
+
+// checkTargetRows 是预检中的目标库非空检查，返回不满足当前处理方式的问题。
+// 断点中已有进度的表是上一次运行写入的，不算作已有数据
+func checkTargetRows(newDB *sql.DB, cp *checkpoint) ([]string, error) {
+	tables, err := nonEmptyTargetTables(newDB)
+	if err != nil {
+		return nil, err
+	}
+	resumed := make(map[string]bool)
+	keyedByID := make(map[string]bool)
+	mergeIDs := make(map[string]bool)
+	for _, tm := range mapping.Tables {
+		keyedByID[tm.Target] = len(tm.Key) == 1 && tm.Key[0] == "id"
+		mergeIDs[tm.Target] = tm.MergeIDs
+		if cp != nil {
+			if t := cp.table(tm.name()); t.Rows > 0 || len(t.Ranges) > 0 {
+				resumed[tm.Target] = true
+			}
+		}
+	}
+
+	var problems []string
+	for _, t := range tables {
+		if resumed[t.Table] && config.TargetMode != targetTruncate {
+			continue
+		}
+		// abilities 会在迁移结束后从 channels 重建，channels 非空时已经会被拦下
+		if t.Table == "abilities" && config.RebuildAbilities && config.TargetMode == targetRequireEmpty {
+			continue
+		}
+		switch config.TargetMode {
+		case targetAllowNonEmpty:
+			fmt.Fprintf(console, "   ⚠️ 目标库表 %s 已有 %d 行，与已有行的冲突按 --conflict 处理\n", t.Table, t.Rows)
+		case targetTruncate:
+			fmt.Fprintf(console, "   🧹 目标库表 %s 已有 %d 行，迁移前将清空\n", t.Table, t.Rows)
+		case targetAppend:
+			if !keyedByID[t.Table] {
+				fmt.Fprintf(console, "   ➕ 目标库表 %s 已有 %d 行，没有 id 列，与已有行的冲突按 --conflict 处理\n", t.Table, t.Rows)
+				continue
+			}
+			fmt.Fprintf(console, "   ➕ 目标库表 %s 已有 %d 行，只追加 id 大于目标库最大 id 的行\n", t.Table, t.Rows)
+		case targetMerge:
+			if !mergeIDs[t.Table] {
+				fmt.Fprintf(console, "   🔀 目标库表 %s 已有 %d 行，不分配新 id，与已有行的冲突按 --conflict 处理\n", t.Table, t.Rows)
+				continue
+			}
+			fmt.Fprintf(console, "   🔀 目标库表 %s 已有 %d 行，合并模式下分配新 id\n", t.Table, t.Rows)
+		default:
+			problems = append(problems, fmt.Sprintf("目标库表 %s 已有 %d 行（可选择 --allow-non-empty、--append、--merge 或 --truncate-target）", t.Table, t.Rows))
+		}
+	}
+	return problems, nil
+}
+
+// truncateTarget 在确认后清空目标库中非空的表；assumeYes 为 false 时从标准输入读取确认
+func truncateTarget(newDB *sql.DB, assumeYes bool) error {
+	newDriver, _ := detectDriver(config.NewDSN)
+	tables, err := nonEmptyTargetTables(newDB)
+	if err != nil || len(tables) == 0 {
+		return err
+	}
+
+	names := make([]string, 0, len(tables))
+	for _, t := range tables {
+		names = append(names, fmt.Sprintf("%s(%d 行)", t.Table, t.Rows))
+	}
+	fmt.Fprintf(console, "🧹 --truncate-target 将删除目标库表中的所有数据: %s\n", strings.Join(names, ", "))
+	if !assumeYes {
+		fmt.Fprint(console, "请输入 yes 确认清空: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+			return fmt.Errorf("未确认清空目标库（非交互运行时请加 --yes）")
+		}
+	}
+
+	tx, err := newDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	for _, t := range tables {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", quoteIdent(newDriver, t.Table))); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("清空目标库表 %s 失败: %w", t.Table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	logEvent("target_truncated", eventFields{"tables": tables}, "✅ 已清空目标库表: %s\n", strings.Join(names, ", "))
+	return nil
+}
+
+// targetMaxID 返回目标库表的最大 id，空表返回 0
+func targetMaxID(newDB *sql.DB, table string) (int64, error) {
+	newDriver, _ := detectDriver(config.NewDSN)
+	var maxID sql.NullInt64
+	err := newDB.QueryRow(fmt.Sprintf("SELECT MAX(%s) FROM %s", quoteIdent(newDriver, "id"), quoteIdent(newDriver, table))).Scan(&maxID)
+	return maxID.Int64, err
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxIssueSamples 是每张表最多输出的问题明细数
+const maxIssueSamples = 20
+
+// errSkipRow 由转换函数返回，表示该行不迁移（如兜底策略为 skip 的渠道）
+var errSkipRow = errors.New("该行按规则跳过")
+
+// issueLog 收集转换中发现但不中断迁移的问题（如密钥格式不符）以及按类别分组的处理结果，迁移结束后按表汇总输出
+type issueLog struct {
+	mu      sync.Mutex
+	Count   int
+	Samples []string
+	// Groups 是处理方式 -> 涉及的行，保持类别首次出现的顺序
+	Groups     map[string][]string
+	groupOrder []string
+}
+
+// group 把一行记入某种处理方式的汇总
+func (l *issueLog) group(category, item string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Groups == nil {
+		l.Groups = make(map[string][]string)
+	}
+	if _, ok := l.Groups[category]; !ok {
+		l.groupOrder = append(l.groupOrder, category)
+	}
+	l.Groups[category] = append(l.Groups[category], item)
+}
+
+func (l *issueLog) empty() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Count == 0 && len(l.Groups) == 0
+}
+
+func (l *issueLog) add(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Count++
+	if len(l.Samples) < maxIssueSamples {
+		l.Samples = append(l.Samples, fmt.Sprintf(format, args...))
+	}
+}
+
+// print 输出问题汇总，indent 为每行前缀
+func (l *issueLog) print(indent string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, category := range l.groupOrder {
+		items := l.Groups[category]
+		shown := items
+		if len(shown) > maxIssueSamples {
+			shown = shown[:maxIssueSamples]
+		}
+		more := ""
+		if len(items) > len(shown) {
+			more = fmt.Sprintf(" 等 %d 行", len(items))
+		}
+		fmt.Fprintf(console, "%s%s: %s%s\n", indent, category, strings.Join(shown, ", "), more)
+	}
+	for _, sample := range l.Samples {
+		fmt.Fprintf(console, "%s- %s\n", indent, sample)
+	}
+	if shown := len(l.Samples); l.Count > shown {
+		fmt.Fprintf(console, "%s- ……其余 %d 处问题未列出\n", indent, l.Count-shown)
+	}
+}
+
+// convertOptions 控制 buildInsertValues 的输出
+type convertOptions struct {
+	// Verbose 为 false 时（dry-run、校验）转换函数不输出日志
+	Verbose bool
+	// Issues 收集转换中发现的问题，为 nil 时不收集
+	Issues *issueLog
+}
+
+// transformContext 是转换函数执行时的上下文
+type transformContext struct {
+	Table  string
+	Column string
+	// Verbose 为 false 时（dry-run、校验）转换函数不输出日志
+	Verbose bool
+
+	issues        *issueLog
+	sourceColumns []string
+	sourceValues  []any
+}
+
+// Report 记录一个不中断迁移的问题
+func (ctx *transformContext) Report(format string, args ...any) {
+	if ctx.issues != nil {
+		ctx.issues.add(format, args...)
+	}
+}
+
+// Group 把当前行记入某种处理方式的汇总
+func (ctx *transformContext) Group(category, item string) {
+	if ctx.issues != nil {
+		ctx.issues.group(category, item)
+	}
+}
+
+// Source 返回当前行中源列的原始值
+func (ctx *transformContext) Source(col string) (any, bool) {
+	idx := indexOf(ctx.sourceColumns, col)
+	if idx == -1 {
+		return nil, false
+	}
+	return ctx.sourceValues[idx], true
+}
+
+// valueTransform 把源库的值转换为写入目标列的值
+type valueTransform func(ctx *transformContext, value any) (any, error)
+
+// transformSpec 是注册的转换，Inputs 是除目标列自身来源外还需要读取的源列
+type transformSpec struct {
+	Apply  valueTransform
+	Inputs []string
+	// Checks 表示转换会通过 Report 报告问题，dry-run 时会逐行转换以预先列出
+	Checks bool
+}
+
+// transforms 是迁移规则中可以按名字引用的转换
+var transforms = map[string]transformSpec{
+	"channel_type":   {Apply: transformChannelType, Inputs: []string{"id", "name", "base_url"}, Checks: true},
+	"channel_status": {Apply: transformChannelStatus, Inputs: []string{"type", "base_url"}},
+	"channel_name":   {Apply: transformChannelName, Inputs: []string{"type", "base_url"}},
+	"channel_key":    {Apply: transformChannelKey, Inputs: []string{"id", "type"}, Checks: true},
+	"channel_config": {Apply: transformChannelConfig, Inputs: []string{"type", "key", "other"}},
+	"token_models":   {Apply: transformTokenModels, Inputs: []string{"setting"}},
+	"token_subnet":   {Apply: transformTokenSubnet, Inputs: []string{"setting"}},
+	"user_unique":    {Apply: transformUserUnique, Inputs: []string{"id"}, Checks: true},
+	"option_key":     {Apply: transformOptionKey, Checks: true},
+	"option_value":   {Apply: transformOptionValue, Inputs: []string{"key"}},
+	"log_stream":     {Apply: transformLogStream},
+	"log_content":    {Apply: transformLogContent, Inputs: []string{"metadata"}},
+}
+
+func transformNames() []string {
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// transformChannelType 把 one-hub 渠道类型映射为 one-api 渠道类型，没有对应类型时按兜底策略处理
+func transformChannelType(ctx *transformContext, value any) (any, error) {
+	baseURL, _ := ctx.Source("base_url")
+	id, _ := ctx.Source("id")
+	var d channelDecision
+	if ctx.Verbose {
+		fmt.Fprintln(console, "🔗 处理渠道类别数据")
+		d = upgradeChannelType(valueString(id), value, valueString(baseURL))
+	} else {
+		d = decideChannel(value, valueString(baseURL))
+	}
+	if d.Fallback != "" {
+		name, _ := ctx.Source("name")
+		ctx.Group(fmt.Sprintf("源类型 %d -> %s", d.SourceType, d.label()), fmt.Sprintf("id=%s(%s)", valueString(id), valueString(name)))
+	}
+	if d.Skip {
+		return nil, errSkipRow
+	}
+	return d.Type, nil
+}
+
+// channelDecisionFor 返回当前行渠道的处理方式
+func channelDecisionFor(ctx *transformContext) (channelDecision, bool) {
+	raw, ok := ctx.Source("type")
+	if !ok {
+		return channelDecision{}, false
+	}
+	baseURL, _ := ctx.Source("base_url")
+	return decideChannel(raw, valueString(baseURL)), true
+}
+
+// transformChannelStatus 把按兜底策略禁用的渠道状态设为手动禁用
+func transformChannelStatus(ctx *transformContext, value any) (any, error) {
+	if d, ok := channelDecisionFor(ctx); ok && d.Disable {
+		return TargetChannelStatusManuallyDisabled, nil
+	}
+	return value, nil
+}
+
+// transformChannelName 在按兜底策略禁用的渠道名称前标记源类型，便于在 one-api 中找到并处理
+func transformChannelName(ctx *transformContext, value any) (any, error) {
+	if d, ok := channelDecisionFor(ctx); ok && d.Disable {
+		return disabledChannelName(d.SourceType, valueString(value)), nil
+	}
+	return value, nil
+}
+
+// transformChannelKey 按 channelKeyLayouts 重排多段密钥，格式不符的密钥原样保留并报告。
+// 只有渠道按布局对应的目标类型迁移时才重排，被禁用或按兜底策略迁移为其他类型的渠道保留原密钥
+func transformChannelKey(ctx *transformContext, value any) (any, error) {
+	d, ok := channelDecisionFor(ctx)
+	if !ok || value == nil {
+		return value, nil
+	}
+	key, _, err := upgradeChannelKey(d.SourceType, d.Type, valueString(value))
+	if err != nil {
+		id, _ := ctx.Source("id")
+		ctx.Report("渠道 id=%s（源类型 %d）的密钥格式不符: %v，已原样保留", valueString(id), d.SourceType, err)
+		return value, nil
+	}
+	return key, nil
+}
+
+// transformChannelConfig 把多段密钥中的字段和 other 等列写入 one-api 渠道的 config JSON
+func transformChannelConfig(ctx *transformContext, value any) (any, error) {
+	d, ok := channelDecisionFor(ctx)
+	if !ok {
+		return value, nil
+	}
+	layout, found := channelKeyLayoutFor(d.SourceType, d.Type)
+	if !found {
+		return value, nil
+	}
+	key, _ := ctx.Source("key")
+	// 密钥格式不符已由 channel_key 报告，这里只跳过密钥中的字段
+	_, keyFields, _ := upgradeChannelKey(d.SourceType, d.Type, valueString(key))
+	fields := make(map[string]any, len(keyFields)+len(layout.Columns))
+	for field, v := range keyFields {
+		fields[field] = v
+	}
+	for field, col := range layout.Columns {
+		if v, ok := ctx.Source(col); ok {
+			fields[field] = v
+		}
+	}
+	// one-api 的 config 字段均为字符串（如 vertex_ai_adc 保存 JSON 文本）
+	return foldJSON(value, fields, false)
+}
+
+// oneHubTokenSetting 是 one-hub tokens.setting 中与访问限制相关的部分
+type oneHubTokenSetting struct {
+	Limits struct {
+		LimitModelSetting struct {
+			Enabled bool     `json:"enabled"`
+			Models  []string `json:"models"`
+		} `json:"limit_model_setting"`
+		LimitsIPSetting struct {
+			Enabled   bool     `json:"enabled"`
+			Whitelist []string `json:"whitelist"`
+		} `json:"limits_ip_setting"`
+	} `json:"limits"`
+}
+
+func parseTokenSetting(ctx *transformContext) (oneHubTokenSetting, bool) {
+	var setting oneHubTokenSetting
+	raw, ok := ctx.Source("setting")
+	if !ok {
+		return setting, false
+	}
+	text := strings.TrimSpace(valueString(raw))
+	if text == "" {
+		return setting, false
+	}
+	if err := json.Unmarshal([]byte(text), &setting); err != nil {
+		return setting, false
+	}
+	return setting, true
+}
+
+// transformTokenModels 把 one-hub 令牌的模型限制转换为 one-api tokens.models（逗号分隔）
+func transformTokenModels(ctx *transformContext, value any) (any, error) {
+	setting, ok := parseTokenSetting(ctx)
+	if !ok || !setting.Limits.LimitModelSetting.Enabled {
+		return keepOrEmpty(value), nil
+	}
+	return strings.Join(setting.Limits.LimitModelSetting.Models, ","), nil
+}
+
+// transformTokenSubnet 把 one-hub 令牌的 IP 白名单转换为 one-api tokens.subnet（逗号分隔）
+func transformTokenSubnet(ctx *transformContext, value any) (any, error) {
+	setting, ok := parseTokenSetting(ctx)
+	if !ok || !setting.Limits.LimitsIPSetting.Enabled {
+		return keepOrEmpty(value), nil
+	}
+	return strings.Join(setting.Limits.LimitsIPSetting.Whitelist, ","), nil
+}
+
+func keepOrEmpty(value any) any {
+	if value == nil {
+		return ""
+	}
+	return value
+}
+
+// valueString 把驱动扫描出的值转换为字符串，NULL 为空字符串
+func valueString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// foldJSON 把源列的值作为字段合并进 base 表示的 JSON 对象，空值不写入。
+// embed 为 true 时源值本身是 JSON 对象/数组的按 JSON 嵌入，否则一律按字符串写入。
+func foldJSON(base any, fields map[string]any, embed bool) (any, error) {
+	obj := make(map[string]any)
+	if text := strings.TrimSpace(valueString(base)); text != "" {
+		if err := json.Unmarshal([]byte(text), &obj); err != nil {
+			return nil, fmt.Errorf("原有值不是 JSON 对象: %w", err)
+		}
+	}
+	for field, value := range fields {
+		text := strings.TrimSpace(valueString(value))
+		if text == "" {
+			continue
+		}
+		if embed && (strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[")) && json.Valid([]byte(text)) {
+			obj[field] = json.RawMessage(text)
+			continue
+		}
+		obj[field] = text
+	}
+	if len(obj) == 0 {
+		return base, nil
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// buildInsertValues 按列映射把一行源数据转换为目标列的值，values 与 cols.SourceColumns 一一对应
+func buildInsertValues(values []any, cols resolvedColumns, table string, opts convertOptions) ([]any, error) {
+	insertValues := make([]any, 0, len(cols.Columns))
+	for _, col := range cols.Columns {
+		var value any
+		if col.Source == "" {
+			value = col.Default
+		} else {
+			value = values[indexOf(cols.SourceColumns, col.Source)]
+		}
+		if len(col.Fold) > 0 {
+			fields := make(map[string]any, len(col.Fold))
+			for field, src := range col.Fold {
+				fields[field] = values[indexOf(cols.SourceColumns, src)]
+			}
+			folded, err := foldJSON(value, fields, true)
+			if err != nil {
+				return nil, fmt.Errorf("列 %s 合并 JSON 失败: %w", col.Target, err)
+			}
+			value = folded
+		}
+		if col.Transform != "" {
+			ctx := &transformContext{
+				Table:         table,
+				Column:        col.Target,
+				Verbose:       opts.Verbose,
+				issues:        opts.Issues,
+				sourceColumns: cols.SourceColumns,
+				sourceValues:  values,
+			}
+			converted, err := transforms[col.Transform].Apply(ctx, value)
+			if err != nil {
+				return nil, fmt.Errorf("列 %s 转换(%s)失败: %w", col.Target, col.Transform, err)
+			}
+			value = converted
+		}
+		if ids != nil {
+			remapped, err := ids.rewrite(table, col.Target, value)
+			if err != nil {
+				return nil, fmt.Errorf("列 %s: %w", col.Target, err)
+			}
+			value = remapped
+		}
+		insertValues = append(insertValues, value)
+	}
+	return insertValues, nil
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxVerifySamples 是每张表最多输出的不一致样例数
+const maxVerifySamples = 10
+
+// tableVerification 是单张表的校验结果
+type tableVerification struct {
+	Table string
+	// Skipped 是没有需要校验的数据的原因（源库没有该表或没有可迁移的字段），不算失败
+	Skipped string
+	// Error 是无法完成校验的原因（目标库缺表、没有可比较的主键、查询失败），算作失败
+	Error   string
+	Columns []string
+
+	SourceRows int64
+	TargetRows int64
+	// id 范围，仅对以 id 为主键的表有效
+	SourceMinID, SourceMaxID int64
+	TargetMinID, TargetMaxID int64
+
+	// Missing 是源库有、目标库没有的行数
+	Missing int64
+	// Different 是两端都有但共有字段内容不同的行数
+	Different int64
+	// Extra 是目标库有、源库没有的行数（目标库原有数据，不算失败）
+	Extra int64
+	// Kept 是按 --options-policy keep 保留了目标库原值的配置项行数（不算失败）
+	Kept    int64
+	Samples []string
+
+	// byID 表示按 id 归并比较，输出 id 范围
+	byID bool
+	// keepTarget 表示内容不同的行是有意保留的目标库原值
+	keepTarget bool
+	// window 描述 --logs-since/--logs-until 限定的时间范围，源库只比较范围内的行
+	window string
+}
+
+func (v tableVerification) failed() bool {
+	return v.Error != "" || v.Missing > 0 || v.Different > 0
+}
+
+func (v *tableVerification) addSample(format string, args ...any) {
+	if len(v.Samples) < maxVerifySamples {
+		v.Samples = append(v.Samples, fmt.Sprintf(format, args...))
+	}
+}
+
+// verifyMigration 逐表比较源库与目标库的行数、id 范围和逐行校验和，全部通过时返回 true
+func verifyMigration(oldDB, newDB *sql.DB) bool {
+	fmt.Fprintln(console, "======================")
+	fmt.Fprintln(console, "🔍 正在校验迁移结果（比较源库与目标库）")
+	ok := true
+	for _, tm := range mapping.Tables {
+		result := verifyTable(oldDB, newDB, tm)
+		printTableVerification(result)
+		if result.failed() {
+			ok = false
+		}
+		if logsRollupEnabled(tm) {
+			rollup := verifyLogsRollup(oldDB, newDB, tm)
+			printTableVerification(rollup)
+			if rollup.failed() {
+				ok = false
+			}
+		}
+	}
+	if ok {
+		fmt.Fprintln(console, "✅ 校验通过：源库的所有行均已写入目标库且内容一致")
+	} else {
+		fmt.Fprintln(console, "❌ 校验未通过：存在缺失或不一致的行，或有表无法校验，详见上方报告")
+	}
+	return ok
+}
+
+// verifyTable 在 migrateTable 使用的列映射上比较一张表，源库的值按迁移规则转换后再比较
+func verifyTable(oldDB, newDB *sql.DB, tm TableMapping) tableVerification {
+	oldDriver, _ := detectDriver(config.OldDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+
+	result := tableVerification{Table: tm.name()}
+	result.keepTarget = tm.Target == "options" && config.Conflict.forTable(tm.Target) == conflictIgnore
+
+	cols, ok := resolveVerifyTable(oldDB, newDB, tm, &result)
+	if !ok {
+		return result
+	}
+
+	keys := tm.Key
+	for _, k := range keys {
+		if !contains(result.Columns, k) {
+			keys = nil
+			break
+		}
+	}
+
+	convert := func(values []any) ([]any, error) {
+		return buildInsertValues(values, cols, tm.Target, convertOptions{})
+	}
+	src := verifySide{db: oldDB, driver: oldDriver, table: tm.Source, columns: cols.SourceColumns, convert: convert}
+	src.where, src.args = logsFilter(tm, oldDriver, 1)
+	result.window = logsWindow(tm)
+	dst := verifySide{db: newDB, driver: newDriver, table: tm.Target, columns: result.Columns}
+	if logsRollupEnabled(tm) {
+		// 汇总行由 verifyLogsRollup 单独比较
+		dst.where, dst.args = logsRollupTarget(newDriver, true)
+	}
+
+	var err error
+	switch {
+	case len(keys) == 1 && keys[0] == "id":
+		result.byID = true
+		src.orderBy = cols.sourceFor("id")
+		dst.orderBy = "id"
+		err = verifyByID(src, dst, &result)
+	case len(keys) > 0:
+		err = verifyByKey(src, dst, keys, &result)
+	default:
+		result.Error = "没有可用于比较的主键"
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("校验失败: %v", err)
+	}
+	return result
+}
+
+// resolveVerifyTable 解析表 tm 用于校验的列映射。源库没有该表时没有需要校验的数据，记为跳过；
+// 源库有数据而目标库缺表时记为失败，避免什么都没有比较却报告校验通过
+func resolveVerifyTable(oldDB, newDB *sql.DB, tm TableMapping, result *tableVerification) (resolvedColumns, bool) {
+	cols, skip := resolveTable(oldDB, newDB, tm)
+	if skip == "" {
+		result.Columns = cols.targetNames()
+		return cols, true
+	}
+	oldDriver, _ := detectDriver(config.OldDSN)
+	newDriver, _ := detectDriver(config.NewDSN)
+	if len(getColumns(oldDB, tm.Source, oldDriver)) > 0 && len(getColumns(newDB, tm.Target, newDriver)) == 0 {
+		result.Error = skip
+	} else {
+		result.Skipped = skip
+	}
+	return cols, false
+}
+
+// verifyByID 按 id 顺序同时遍历两端（归并比较），不需要把整张表载入内存
+func verifyByID(srcSide, dstSide verifySide, result *tableVerification) error {
+	src, err := srcSide.open()
+	if err != nil {
+		return fmt.Errorf("查询源库: %w", err)
+	}
+	defer src.close()
+	dst, err := dstSide.open()
+	if err != nil {
+		return fmt.Errorf("查询目标库: %w", err)
+	}
+	defer dst.close()
+
+	idIdx := indexOf(result.Columns, "id")
+	srcOK, err := src.next()
+	if err != nil {
+		return err
+	}
+	dstOK, err := dst.next()
+	if err != nil {
+		return err
+	}
+	var srcID, dstID int64
+	for srcOK || dstOK {
+		if srcOK {
+			if srcID, err = toInt64(src.values[idIdx]); err != nil {
+				return fmt.Errorf("解析源库 id: %w", err)
+			}
+		}
+		if dstOK {
+			if dstID, err = toInt64(dst.values[idIdx]); err != nil {
+				return fmt.Errorf("解析目标库 id: %w", err)
+			}
+		}
+
+		switch {
+		case srcOK && (!dstOK || srcID < dstID):
+			trackIDRange(&result.SourceRows, &result.SourceMinID, &result.SourceMaxID, srcID)
+			result.Missing++
+			result.addSample("id=%d 目标库中不存在", srcID)
+			if srcOK, err = src.next(); err != nil {
+				return err
+			}
+		case dstOK && (!srcOK || dstID < srcID):
+			trackIDRange(&result.TargetRows, &result.TargetMinID, &result.TargetMaxID, dstID)
+			result.Extra++
+			if dstOK, err = dst.next(); err != nil {
+				return err
+			}
+		default:
+			trackIDRange(&result.SourceRows, &result.SourceMinID, &result.SourceMaxID, srcID)
+			trackIDRange(&result.TargetRows, &result.TargetMinID, &result.TargetMaxID, dstID)
+			if src.checksum() != dst.checksum() {
+				result.Different++
+				result.addSample("id=%d 字段不一致: %v", srcID, diffColumns(result.Columns, src.normalized, dst.normalized))
+			}
+			if srcOK, err = src.next(); err != nil {
+				return err
+			}
+			if dstOK, err = dst.next(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyByKey 适用于非整数主键的小表（options、abilities），把目标库整表载入内存后比较
+func verifyByKey(srcSide, dstSide verifySide, keys []string, result *tableVerification) error {
+	dst, err := dstSide.open()
+	if err != nil {
+		return fmt.Errorf("查询目标库: %w", err)
+	}
+	defer dst.close()
+
+	keyIdx := make([]int, 0, len(keys))
+	for _, k := range keys {
+		keyIdx = append(keyIdx, indexOf(result.Columns, k))
+	}
+	rowKey := func(normalized []string) string {
+		parts := make([]string, 0, len(keyIdx))
+		for _, i := range keyIdx {
+			parts = append(parts, normalized[i])
+		}
+		return strings.Join(parts, "|")
+	}
+
+	target := make(map[string][]string)
+	for {
+		ok, err := dst.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		result.TargetRows++
+		target[rowKey(dst.normalized)] = append([]string(nil), dst.normalized...)
+	}
+
+	src, err := srcSide.open()
+	if err != nil {
+		return fmt.Errorf("查询源库: %w", err)
+	}
+	defer src.close()
+
+	matched := 0
+	for {
+		ok, err := src.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		result.SourceRows++
+		key := rowKey(src.normalized)
+		row, found := target[key]
+		if !found {
+			result.Missing++
+			result.addSample("%v=%s 目标库中不存在", keys, key)
+			continue
+		}
+		matched++
+		if diff := diffColumns(result.Columns, src.normalized, row); len(diff) > 0 {
+			if result.keepTarget {
+				result.Kept++
+				continue
+			}
+			result.Different++
+			result.addSample("%v=%s 字段不一致: %v", keys, key, diff)
+		}
+	}
+	result.Extra = result.TargetRows - int64(matched)
+	return nil
+}
+
+func trackIDRange(count, minID, maxID *int64, id int64) {
+	if *count == 0 || id < *minID {
+		*minID = id
+	}
+	if *count == 0 || id > *maxID {
+		*maxID = id
+	}
+	*count++
+}
+
+func diffColumns(columns []string, a, b []string) []string {
+	var diff []string
+	for i, col := range columns {
+		if a[i] != b[i] {
+			diff = append(diff, col)
+		}
+	}
+	return diff
+}
+
+// verifySide 描述校验时要读取的一端：源库读取源列并按迁移规则转换，目标库直接读取目标列
+type verifySide struct {
+	db      *sql.DB
+	driver  string
+	table   string
+	columns []string
+	orderBy string
+	// where/args 是只读取部分行时的过滤条件（不含 WHERE）
+	where string
+	args  []any
+	// rows 非 nil 时代替查询，逐行比较这些已读取的行（如在 Go 中汇总的日志）
+	rows    [][]any
+	convert func([]any) ([]any, error)
+}
+
+func (s verifySide) open() (*verifyCursor, error) {
+	if s.rows != nil {
+		return &verifyCursor{pending: s.rows, convert: s.convert}, nil
+	}
+	quoted := make([]string, 0, len(s.columns))
+	for _, col := range s.columns {
+		quoted = append(quoted, quoteIdent(s.driver, col))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ","), quoteIdent(s.driver, s.table))
+	if s.where != "" {
+		query += " WHERE " + s.where
+	}
+	if s.orderBy != "" {
+		query += " ORDER BY " + quoteIdent(s.driver, s.orderBy)
+	}
+	rows, err := s.db.Query(query, s.args...)
+	if err != nil {
+		return nil, err
+	}
+	c := &verifyCursor{
+		rows:    rows,
+		convert: s.convert,
+		raw:     make([]any, len(s.columns)),
+		ptrs:    make([]any, len(s.columns)),
+	}
+	for i := range c.raw {
+		c.ptrs[i] = &c.raw[i]
+	}
+	return c, nil
+}
+
+// verifyCursor 逐行读取并把值归一化为与驱动无关的字符串
+type verifyCursor struct {
+	rows *sql.Rows
+	// pending 是 verifySide.rows 中尚未读取的行
+	pending [][]any
+	convert func([]any) ([]any, error)
+	raw     []any
+	ptrs    []any
+	// values 是（转换后的）目标列值，normalized 是其归一化结果
+	values     []any
+	normalized []string
+}
+
+func (c *verifyCursor) next() (bool, error) {
+	for {
+		switch {
+		case c.rows == nil && len(c.pending) == 0:
+			return false, nil
+		case c.rows == nil:
+			c.raw, c.pending = c.pending[0], c.pending[1:]
+		case !c.rows.Next():
+			return false, c.rows.Err()
+		default:
+			if err := c.rows.Scan(c.ptrs...); err != nil {
+				return false, err
+			}
+		}
+		c.values = c.raw
+		if c.convert == nil {
+			break
+		}
+		converted, err := c.convert(c.raw)
+		// 迁移时按规则跳过的行不参与比较
+		if errors.Is(err, errSkipRow) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		c.values = converted
+		break
+	}
+	c.normalized = c.normalized[:0]
+	for _, value := range c.values {
+		c.normalized = append(c.normalized, normalizeValue(value))
+	}
+	return true, nil
+}
+
+func (c *verifyCursor) checksum() [32]byte {
+	return sha256.Sum256([]byte(strings.Join(c.normalized, "\x1f")))
+}
+
+func (c *verifyCursor) close() {
+	if c.rows != nil {
+		_ = c.rows.Close()
+	}
+}
+
+// normalizeValue 把不同驱动扫描出的值转换为可比较的字符串：
+// 数字统一格式，布尔值转为 0/1，时间统一为 UTC
+func normalizeValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "\x00"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return normalizeFloat(v)
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05")
+	case []byte:
+		return normalizeText(string(v))
+	case string:
+		return normalizeText(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func normalizeText(s string) string {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return normalizeFloat(f)
+	}
+	switch s {
+	case "true":
+		return "1"
+	case "false":
+		return "0"
+	}
+	return s
+}
+
+func normalizeFloat(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func printTableVerification(v tableVerification) {
+	if v.Skipped != "" {
+		fmt.Fprintf(console, "⚠️ 表 %s 未校验: %s\n", v.Table, v.Skipped)
+		return
+	}
+	if v.Error != "" {
+		fmt.Fprintf(console, "❌ 表 %s 无法校验: %s\n", v.Table, v.Error)
+		return
+	}
+	status := "✅"
+	if v.failed() {
+		status = "❌"
+	}
+	fmt.Fprintf(console, "%s 表 %s: 源库 %d 行 / 目标库 %d 行，缺失 %d 行，不一致 %d 行，目标库多出 %d 行\n",
+		status, v.Table, v.SourceRows, v.TargetRows, v.Missing, v.Different, v.Extra)
+	if v.window != "" {
+		fmt.Fprintf(console, "   源库只比较 %s 的行\n", v.window)
+	}
+	if v.Kept > 0 {
+		fmt.Fprintf(console, "   保留目标库原值 %d 行（--options-policy keep）\n", v.Kept)
+	}
+	if v.SourceRows > 0 || v.TargetRows > 0 {
+		if v.byID {
+			fmt.Fprintf(console, "   id 范围: 源库 [%d, %d]，目标库 [%d, %d]\n", v.SourceMinID, v.SourceMaxID, v.TargetMinID, v.TargetMaxID)
+		}
+	}
+	for _, sample := range v.Samples {
+		fmt.Fprintf(console, "   - %s\n", sample)
+	}
+	if shown := int64(len(v.Samples)); v.Missing+v.Different > shown {
+		fmt.Fprintf(console, "   - ……其余 %d 处差异未列出\n", v.Missing+v.Different-shown)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"nil", nil, "\x00"},
+		{"true", true, "1"},
+		{"false", false, "0"},
+		{"int64", int64(42), "42"},
+		{"int", 42, "42"},
+		{"整数 float", float64(42), "42"},
+		{"小数 float", 0.75, "0.75"},
+		{"大数 float", 1e20, "1e+20"},
+		{"数字字符串", "42.0", "42"},
+		{"数字 bytes", []byte("0.750"), "0.75"},
+		{"布尔字符串", "true", "1"},
+		{"布尔 bytes", []byte("false"), "0"},
+		{"普通字符串", "hello", "hello"},
+		{"空字符串", "", ""},
+		{"时间转为 UTC", time.Date(2024, 1, 1, 8, 0, 0, 0, shanghai), "2024-01-01 00:00:00"},
+		{"其他类型", uint8(7), "7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeValue(tt.value); got != tt.want {
+				t.Errorf("normalizeValue(%#v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// 不同驱动扫描出的同一个值归一化后应相同，NULL 与空字符串不同
+func TestNormalizeValueAcrossDrivers(t *testing.T) {
+	same := [][]any{
+		{int64(1), true, "1", []byte("1"), float64(1)},
+		{int64(0), false, "false", []byte("0")},
+		{0.5, "0.5", []byte("0.50")},
+	}
+	for _, group := range same {
+		want := normalizeValue(group[0])
+		for _, v := range group[1:] {
+			if got := normalizeValue(v); got != want {
+				t.Errorf("normalizeValue(%#v) = %q, want %q（与 %#v 相同）", v, got, want, group[0])
+			}
+		}
+	}
+	if normalizeValue(nil) == normalizeValue("") {
+		t.Error("NULL 与空字符串归一化后不应相同")
+	}
+}
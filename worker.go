@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// errCancelled 表示复制因 --fail-fast 在 chunk 边界停止，已提交的部分记录在断点中
+var errCancelled = errors.New("已按 --fail-fast 停止")
+
+// stopMigration 在 --fail-fast 下有表失败后置位，尚未开始的表不再迁移，进行中的表在下一个 chunk 边界停止
+var stopMigration atomic.Bool
+
+// cancelledOnly 表示 err 只由 errCancelled 组成（区间并发时 err 是各区间错误的合并）
+func cancelledOnly(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if !cancelledOnly(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return errors.Is(err, errCancelled)
+}
+
+// workerPool 限制同时复制数据的 goroutine 数量，表级与区间级的复制共用同一组名额
+type workerPool struct {
+	slots chan struct{}
+}
+
+// workers 是全局的复制并发池，由 --workers 设置
+var workers = newWorkerPool(1)
+
+func newWorkerPool(n int) *workerPool {
+	if n < 1 {
+		n = 1
+	}
+	return &workerPool{slots: make(chan struct{}, n)}
+}
+
+func (p *workerPool) size() int {
+	return cap(p.slots)
+}
+
+// run 并发执行 fn(0..n-1)，每次调用占用一个名额，返回所有失败的合并错误
+func (p *workerPool) run(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p.slots <- struct{}{}
+			defer func() { <-p.slots }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// tableCopy 是一张表迁移过程中各区间共享的状态
+type tableCopy struct {
+	oldDB, newDB *sql.DB
+	tm           TableMapping
+	cols         resolvedColumns
+	cp           *checkpoint
+	policy       conflictPolicy
+	limits       batchLimits
+	// idSource 是源表的 id 列，为空时整表在单个事务中复制
+	idSource string
+
+	issues   *issueLog
+	progress *tableProgress
+	// count 是加入批次的行数，read/written/skipped 用于运行汇总
+	count   atomic.Int64
+	read    atomic.Int64
+	written atomic.Int64
+	skipped atomic.Int64
+}
+
+func (run *tableCopy) stats() tableStats {
+	return tableStats{Read: run.read.Load(), Written: run.written.Load(), Skipped: run.skipped.Load()}
+}
+
+// idRange 是一个复制单元：id 在 (After, To] 内的行，To 为 0 表示不设上界。
+// Index 是断点中 Ranges 的下标，-1 表示整表只有一个区间、断点记录在 LastID 中。
+type idRange struct {
+	Index int
+	After int64
+	To    int64
+}
+
+// planRanges 确定可续传表的复制区间：断点中已有区间时继续未完成的区间；
+// 否则在 --workers 大于 1 且剩余行数超过 ChunkSize 时按 id 均分为 workers 个区间并写入断点
+func (run *tableCopy) planRanges(state tableCheckpoint) ([]idRange, error) {
+	table := run.tm.name()
+	if len(state.Ranges) > 0 {
+		var ranges []idRange
+		for i, rc := range state.Ranges {
+			if !rc.Done {
+				ranges = append(ranges, idRange{Index: i, After: rc.LastID, To: rc.To})
+			}
+		}
+		fmt.Fprintf(console, "♻️ 表 %s 从断点继续：%d 个区间未完成（此前已迁移 %d 行）\n", table, len(ranges), state.Rows)
+		return ranges, nil
+	}
+	if state.Rows > 0 {
+		fmt.Fprintf(console, "♻️ 表 %s 从断点继续：id > %d（此前已迁移 %d 行）\n", table, state.LastID, state.Rows)
+	}
+	single := []idRange{{Index: -1, After: state.LastID}}
+	n := workers.size()
+	if n <= 1 {
+		return single, nil
+	}
+
+	oldDriver, _ := detectDriver(config.OldDSN)
+	idIdent := quoteIdent(oldDriver, run.idSource)
+	var (
+		count        int64
+		minID, maxID sql.NullInt64
+	)
+	query := fmt.Sprintf("SELECT COUNT(*), MIN(%s), MAX(%s) FROM %s WHERE %s > %s",
+		idIdent, idIdent, quoteIdent(oldDriver, run.tm.Source), idIdent, placeholderAt(oldDriver, 1))
+	args := []any{state.LastID}
+	if filter, filterArgs := logsFilter(run.tm, oldDriver, 2); filter != "" {
+		query += " AND " + filter
+		args = append(args, filterArgs...)
+	}
+	if err := run.oldDB.QueryRow(query, args...).Scan(&count, &minID, &maxID); err != nil {
+		return nil, fmt.Errorf("统计源库表 %s 的 id 范围失败: %w", run.tm.Source, err)
+	}
+	if !minID.Valid || count <= int64(config.ChunkSize) || maxID.Int64-minID.Int64 < int64(n) {
+		return single, nil
+	}
+
+	// 区间按 id 均分，最后一个区间不设上界，迁移期间新写入源库的行也会被复制
+	step := (maxID.Int64 - minID.Int64 + 1) / int64(n)
+	saved := make([]rangeCheckpoint, 0, n)
+	after := minID.Int64 - 1
+	for i := 0; i < n; i++ {
+		to := after + step
+		if i == n-1 {
+			to = 0
+		}
+		saved = append(saved, rangeCheckpoint{LastID: after, To: to})
+		after = to
+	}
+	err := run.cp.update(table, func(t *tableCheckpoint) {
+		t.Ranges = saved
+	})
+	if err != nil {
+		fmt.Fprintf(console, "⚠️ 写入断点文件失败: %v\n", err)
+	}
+	ranges := make([]idRange, 0, n)
+	for i, rc := range saved {
+		ranges = append(ranges, idRange{Index: i, After: rc.LastID, To: rc.To})
+	}
+	fmt.Fprintf(console, "🧵 表 %s 约 %d 行，按 id 拆分为 %d 个区间并发迁移\n", table, count, n)
+	return ranges, nil
+}
+
+// tableProgress 汇总一张表所有区间已写入的行数，输出的总是整张表的进度
+type tableProgress struct {
+	table   string
+	mu      sync.Mutex
+	written int64
+}
+
+func (p *tableProgress) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.written += int64(n)
+	logEvent("progress", eventFields{"table": p.table, "rows": p.written}, "⏳ 表 %s 已处理 %d 行数据\n", p.table, p.written)
+}